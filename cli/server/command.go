@@ -67,6 +67,17 @@ The host/port to listen for inter-node gossip traffic.
 If the host is unspecified it defaults to all listeners, such as
 '--server.gossip-addr :7000' will listen on '0.0.0.0:7000'`,
 	)
+	cmd.Flags().StringVar(
+		&conf.Server.AdminListenAddr,
+		"server.admin-listen-addr",
+		":8001",
+		`
+The host/port to listen on for the admin HTTP server, used for health
+checks, metrics and cluster status.
+
+If the host is unspecified it defaults to all listeners, such as
+'--server.admin-listen-addr :8001' will listen on '0.0.0.0:8001'`,
+	)
 
 	cmd.Flags().IntVar(
 		&conf.Server.GracePeriodSeconds,
@@ -99,6 +110,101 @@ port is given, the gossip port of this node is used.
 Note each node propagates membership information to the other known nodes,
 so the initial set of configured members only needs to be a subset of nodes.`,
 	)
+	cmd.Flags().IntVar(
+		&conf.Cluster.JoinTimeoutSeconds,
+		"cluster.join-timeout-seconds",
+		30,
+		`
+Maximum number of seconds to wait for the node to join the cluster and
+complete its initial sync with '--cluster.members' during startup.
+
+If the node hasn't joined within the timeout, a warning is logged and the
+'/health/ready' admin endpoint keeps reporting not-ready, but the node
+keeps serving and retrying rather than exiting. Has no effect when
+'--cluster.members' is empty, since a single-node cluster is ready
+immediately.
+
+Note this depends on the gossip transport actually exchanging state with the
+configured members, so until that's implemented a non-empty
+'--cluster.members' will never report ready.`,
+	)
+	cmd.Flags().StringSliceVar(
+		&conf.Cluster.AdvertiseCIDRs,
+		"cluster.advertise-cidrs",
+		nil,
+		`
+An ordered list of CIDR ranges used to select which local IP to advertise
+to the cluster when '--server.listen-addr' or '--server.admin-listen-addr'
+bind to all interfaces.
+
+Such as '--cluster.advertise-cidrs 10.26.104.0/24' will prefer advertising
+an address in that range over other local addresses. If none of the host's
+addresses match any of the given ranges, an arbitrary address is used.`,
+	)
+
+	cmd.Flags().BoolVar(
+		&conf.NAT.Enabled,
+		"nat.enabled",
+		false,
+		`
+Enables NAT traversal, discovering an externally-reachable address for this
+node's proxy and admin listeners (via STUN, UPnP-IGD or NAT-PMP) and
+gossiping it to the rest of the cluster.
+
+This is only needed where nodes sit behind NAT and the addresses given by
+'--server.listen-addr'/'--server.admin-listen-addr' aren't directly
+reachable by other nodes, such as a node running on a home network. It's
+not needed where nodes already gossip directly reachable addresses, such as
+in a Kubernetes cluster.`,
+	)
+	cmd.Flags().StringVar(
+		&conf.NAT.StaticExtAddr,
+		"nat.static-ext-addr",
+		"",
+		`
+A static external host to advertise instead of running NAT discovery, such
+as '--nat.static-ext-addr 203.0.113.10' for a node with a manually
+configured 1:1 port forward.
+
+Only used when '--nat.enabled' is set.`,
+	)
+	cmd.Flags().StringVar(
+		&conf.NAT.STUNServerAddr,
+		"nat.stun-server-addr",
+		"",
+		`
+The STUN server used to discover this node's external address.
+
+STUN can't install a port mapping, so it's only useful as a fallback where
+the NAT already maps the external port straight through to this node's
+internal port (such as many home routers in 'full cone' mode); the
+discovered IP is paired with the internal port, not the (UDP) port STUN
+observes, since STUN traffic itself is always sent over UDP regardless of
+the proto being mapped.
+
+Defaults to a public Google STUN server. Only used when '--nat.enabled' is
+set.`,
+	)
+	cmd.Flags().StringVar(
+		&conf.NAT.NATPMPGatewayAddr,
+		"nat.pmp-gateway-addr",
+		"",
+		`
+The address of the gateway to contact via NAT-PMP, instead of using the
+default route.
+
+Only used when '--nat.enabled' is set.`,
+	)
+	cmd.Flags().BoolVar(
+		&conf.NAT.DisableUPnP,
+		"nat.disable-upnp",
+		false,
+		`
+Disables UPnP-IGD discovery, such as where it's known to be unsupported or
+disabled on the network.
+
+Only used when '--nat.enabled' is set.`,
+	)
 
 	cmd.Flags().IntVar(
 		&conf.Proxy.TimeoutSeconds,
@@ -177,19 +283,28 @@ Such as you can enable 'gossip' logs with '--log.subsystems gossip'.`,
 func run(conf *config.Config, logger *log.Logger) {
 	logger.Info("starting pico server", zap.Any("conf", conf))
 
+	localNode := &netmap.Node{
+		ID:        netmap.GenerateNodeID(),
+		Status:    netmap.NodeStatusActive,
+		ProxyAddr: conf.Server.ListenAddr,
+		AdminAddr: conf.Server.AdminListenAddr,
+	}
+	nm := netmap.NewNetworkMap(localNode, logger)
+	gossip, err := gossip.NewGossip(nm, conf, logger)
+	if err != nil {
+		logger.Error("failed to create gossip", zap.Error(err))
+		os.Exit(1)
+	}
+
 	registry := prometheus.NewRegistry()
 	server := server.NewServer(
 		conf.Server.ListenAddr,
 		registry,
 		conf,
+		gossip,
 		logger,
 	)
 
-	netmap := netmap.NewNetworkMap()
-	// TODO(andydunstall): Should wait for gossip to join and sync before
-	// the server becomes ready.
-	gossip := gossip.NewGossip(netmap, logger)
-
 	ctx, cancel := signal.NotifyContext(
 		context.Background(), syscall.SIGINT, syscall.SIGTERM,
 	)
@@ -224,6 +339,30 @@ func run(conf *config.Config, logger *log.Logger) {
 		}
 		return nil
 	})
+	g.Go(func() error {
+		joinCtx, cancel := context.WithTimeout(
+			ctx, time.Duration(conf.Cluster.JoinTimeoutSeconds)*time.Second,
+		)
+		defer cancel()
+		if err := gossip.Ready(joinCtx); err != nil {
+			if ctx.Err() != nil {
+				// Shutting down before the node finished joining isn't a
+				// join failure.
+				return nil
+			}
+			// Not fatal: the node keeps serving and /health/ready keeps
+			// reporting not-ready via gossip.IsReady(), so an orchestrator
+			// can act on it, rather than this goroutine killing an
+			// otherwise-healthy process.
+			logger.Warn(
+				"cluster join timed out; node will keep retrying",
+				zap.Error(err),
+			)
+			return nil
+		}
+		logger.Info("node ready")
+		return nil
+	})
 
 	if err := g.Wait(); err != nil {
 		logger.Error("failed to run server", zap.Error(err))
@@ -0,0 +1,196 @@
+// Package ifacewatch watches the host's network interfaces for changes to
+// the set of usable (up, non-loopback) IP addresses, such as due to DHCP
+// renewal, a VPN connecting/disconnecting, or a container/pod being
+// rescheduled with a new IP.
+package ifacewatch
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"go.uber.org/zap"
+)
+
+// DefaultPollInterval is how often the watcher falls back to polling
+// net.Interfaces() for changes, used as a backstop on platforms (or in
+// environments) where OS route-change notifications aren't available.
+const DefaultPollInterval = 15 * time.Second
+
+// Source returns the set of IP addresses currently considered usable on the
+// host. It's an interface so tests can inject a fake.
+type Source interface {
+	Addrs() ([]netip.Addr, error)
+}
+
+type interfaceSource struct{}
+
+func (interfaceSource) Addrs() ([]netip.Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifaceAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			if addr.IsLoopback() || !addr.IsValid() {
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return sortedAddrs(addrs), nil
+}
+
+// DefaultSource returns the Source used in production, which reads directly
+// from net.Interfaces().
+func DefaultSource() Source {
+	return interfaceSource{}
+}
+
+// routeNotifier is implemented per-platform to wake the watcher as soon as
+// the OS reports a route/address table change, rather than waiting for the
+// next poll tick. Platforms without an implementation use a no-op.
+type routeNotifier interface {
+	// Run blocks until ctx is cancelled, sending to notifyCh (non-blocking)
+	// whenever the route table changes.
+	Run(ctx context.Context, notifyCh chan<- struct{})
+}
+
+// Watcher polls a Source on a tick (and reacts immediately to OS route
+// table notifications where available) and emits the new address set
+// whenever it differs from the last observed set.
+type Watcher struct {
+	source   Source
+	interval time.Duration
+	notifier routeNotifier
+
+	// notifyCh is a size-1 buffered channel: a pending notification is
+	// enough to trigger a single re-check, so bursts of route changes
+	// coalesce into one re-read of the interface set rather than queuing a
+	// re-check per event.
+	notifyCh chan struct{}
+
+	subscribers []chan []netip.Addr
+
+	logger *log.Logger
+}
+
+// NewWatcher creates a watcher that polls source every interval for
+// changes.
+func NewWatcher(source Source, interval time.Duration, logger *log.Logger) *Watcher {
+	return &Watcher{
+		source:   source,
+		interval: interval,
+		notifier: newRouteNotifier(),
+		notifyCh: make(chan struct{}, 1),
+		logger:   logger,
+	}
+}
+
+// Subscribe returns a channel that receives the new set of addresses
+// whenever it changes. Must be called before Run.
+func (w *Watcher) Subscribe() <-chan []netip.Addr {
+	ch := make(chan []netip.Addr, 1)
+	w.subscribers = append(w.subscribers, ch)
+	return ch
+}
+
+// Run polls for interface changes until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	go w.notifier.Run(ctx, w.notifyCh)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	last, err := w.source.Addrs()
+	if err != nil {
+		w.logger.Warn("failed to read interface addrs", zap.Error(err))
+	} else {
+		// Emit the initial set too, not just subsequent changes, so
+		// subscribers that resolve an advertised address from it (such as
+		// the gossip readvertiser) don't advertise an unresolved bind
+		// address until the interfaces happen to change.
+		w.notify(last)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-w.notifyCh:
+		}
+
+		addrs, err := w.source.Addrs()
+		if err != nil {
+			w.logger.Warn("failed to read interface addrs", zap.Error(err))
+			continue
+		}
+		if addrsEqual(addrs, last) {
+			continue
+		}
+
+		last = addrs
+		w.notify(addrs)
+	}
+}
+
+func (w *Watcher) notify(addrs []netip.Addr) {
+	for _, ch := range w.subscribers {
+		select {
+		case ch <- addrs:
+		default:
+			// Subscriber hasn't consumed the previous update yet; drop the
+			// stale one rather than blocking the watch loop.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- addrs
+		}
+	}
+}
+
+func sortedAddrs(addrs []netip.Addr) []netip.Addr {
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].String() < addrs[j].String()
+	})
+	return addrs
+}
+
+func addrsEqual(a, b []netip.Addr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
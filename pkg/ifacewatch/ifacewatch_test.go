@@ -0,0 +1,119 @@
+package ifacewatch
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	mu    sync.Mutex
+	addrs []netip.Addr
+}
+
+func (s *fakeSource) Addrs() ([]netip.Addr, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addrs, nil
+}
+
+func (s *fakeSource) set(addrs []netip.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addrs = addrs
+}
+
+func TestWatcher_NotifiesInitialAddrs(t *testing.T) {
+	source := &fakeSource{addrs: []netip.Addr{netip.MustParseAddr("10.0.0.1")}}
+
+	w := NewWatcher(source, time.Second, log.NewNopLogger())
+	updates := w.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		_ = w.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case addrs := <-updates:
+		assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.1")}, addrs)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for initial addrs")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestWatcher_NotifiesOnChange(t *testing.T) {
+	source := &fakeSource{addrs: []netip.Addr{netip.MustParseAddr("10.0.0.1")}}
+
+	w := NewWatcher(source, 5*time.Millisecond, log.NewNopLogger())
+	updates := w.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		_ = w.Run(ctx)
+		close(done)
+	}()
+
+	source.set([]netip.Addr{netip.MustParseAddr("10.0.0.2")})
+
+	select {
+	case addrs := <-updates:
+		assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.2")}, addrs)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for update")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestWatcher_CoalescesRapidChanges(t *testing.T) {
+	source := &fakeSource{addrs: []netip.Addr{netip.MustParseAddr("10.0.0.1")}}
+
+	w := NewWatcher(source, time.Millisecond, log.NewNopLogger())
+	updates := w.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		_ = w.Run(ctx)
+		close(done)
+	}()
+
+	// Several rapid changes should coalesce: the subscriber is only
+	// guaranteed to observe the latest value, never a backlog.
+	for i := 2; i <= 5; i++ {
+		source.set([]netip.Addr{netip.MustParseAddr("10.0.0." + strconv.Itoa(i))})
+	}
+
+	var last []netip.Addr
+	for {
+		select {
+		case addrs := <-updates:
+			last = addrs
+		case <-time.After(50 * time.Millisecond):
+			assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.5")}, last)
+			cancel()
+			<-done
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package ifacewatch
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// bsdRouteNotifier wakes the watcher immediately on address/link changes by
+// reading from a PF_ROUTE socket, rather than waiting for the next poll
+// tick.
+type bsdRouteNotifier struct{}
+
+func newRouteNotifier() routeNotifier {
+	return bsdRouteNotifier{}
+}
+
+func (bsdRouteNotifier) Run(ctx context.Context, notifyCh chan<- struct{}) {
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+	if err != nil {
+		// The route socket isn't available (such as a restricted sandbox);
+		// the watcher falls back to polling on its ticker alone.
+		return
+	}
+	// closeOnce guards fd: it's closed either by the ctx.Done() goroutine
+	// below (to unblock Read) or by the defer once Read returns, whichever
+	// happens first. Closing twice would risk closing an unrelated fd the
+	// kernel has since reused.
+	var closeOnce sync.Once
+	closeFd := func() { closeOnce.Do(func() { unix.Close(fd) }) }
+	defer closeFd()
+
+	go func() {
+		<-ctx.Done()
+		closeFd()
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			return
+		}
+
+		select {
+		case notifyCh <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package ifacewatch
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// linuxRouteNotifier wakes the watcher immediately on address/link changes
+// by subscribing to the kernel's NETLINK_ROUTE multicast groups, rather than
+// waiting for the next poll tick.
+type linuxRouteNotifier struct{}
+
+func newRouteNotifier() routeNotifier {
+	return linuxRouteNotifier{}
+}
+
+func (linuxRouteNotifier) Run(ctx context.Context, notifyCh chan<- struct{}) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+	if err != nil {
+		// Netlink isn't available (such as a restricted sandbox); the
+		// watcher falls back to polling on its ticker alone.
+		return
+	}
+	// closeOnce guards fd: it's closed either by the ctx.Done() goroutine
+	// below (to unblock Recvfrom) or by the defer once Recvfrom returns,
+	// whichever happens first. Closing twice would risk closing an
+	// unrelated fd the kernel has since reused.
+	var closeOnce sync.Once
+	closeFd := func() { closeOnce.Do(func() { unix.Close(fd) }) }
+	defer closeFd()
+
+	addr := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}
+	if err := unix.Bind(fd, addr); err != nil {
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		closeFd()
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			return
+		}
+
+		select {
+		case notifyCh <- struct{}{}:
+		default:
+		}
+	}
+}
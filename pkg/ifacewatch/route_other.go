@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package ifacewatch
+
+import "context"
+
+// noopRouteNotifier is used on platforms without a route-socket
+// implementation (such as Windows); the watcher still works, falling back
+// to polling on its ticker alone.
+type noopRouteNotifier struct{}
+
+func newRouteNotifier() routeNotifier {
+	return noopRouteNotifier{}
+}
+
+func (noopRouteNotifier) Run(ctx context.Context, _ chan<- struct{}) {
+	<-ctx.Done()
+}
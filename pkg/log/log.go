@@ -0,0 +1,109 @@
+// Package log provides the logger used throughout Pico, which wraps zap to
+// support enabling debug logs for individual subsystems.
+package log
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Logger wraps zap.Logger, additionally supporting enabling debug logs for a
+// configured set of subsystems regardless of the global log level.
+type Logger struct {
+	logger      *zap.Logger
+	debugLogger *zap.Logger
+	subsystems  map[string]struct{}
+}
+
+// NewLogger creates a logger that logs at the given level, such as 'debug',
+// 'info', 'warn' or 'error'.
+//
+// Any subsystem in 'subsystems' will log at debug regardless of 'level'.
+func NewLogger(level string, subsystems []string) (*Logger, error) {
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoder := zapcore.NewConsoleEncoder(encoderConfig)
+	sink := zapcore.Lock(os.Stdout)
+
+	subsystemSet := make(map[string]struct{}, len(subsystems))
+	for _, s := range subsystems {
+		subsystemSet[s] = struct{}{}
+	}
+
+	return &Logger{
+		logger:      zap.New(zapcore.NewCore(encoder, sink, zapLevel)),
+		debugLogger: zap.New(zapcore.NewCore(encoder, sink, zapcore.DebugLevel)),
+		subsystems:  subsystemSet,
+	}, nil
+}
+
+// NewObservedLogger returns a logger backed by an observer.ObservedLogs, so
+// tests can assert on the fields and messages logged without parsing
+// console output.
+func NewObservedLogger() (*Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	zl := zap.New(core)
+	return &Logger{
+		logger:      zl,
+		debugLogger: zl,
+		subsystems:  make(map[string]struct{}),
+	}, logs
+}
+
+// NewNopLogger returns a logger that discards all logs, for use in tests.
+func NewNopLogger() *Logger {
+	nop := zap.NewNop()
+	return &Logger{
+		logger:      nop,
+		debugLogger: nop,
+		subsystems:  make(map[string]struct{}),
+	}
+}
+
+func (l *Logger) Debug(msg string, fields ...zap.Field) {
+	l.logger.Debug(msg, fields...)
+}
+
+func (l *Logger) Info(msg string, fields ...zap.Field) {
+	l.logger.Info(msg, fields...)
+}
+
+func (l *Logger) Warn(msg string, fields ...zap.Field) {
+	l.logger.Warn(msg, fields...)
+}
+
+func (l *Logger) Error(msg string, fields ...zap.Field) {
+	l.logger.Error(msg, fields...)
+}
+
+// With returns a logger with the given fields added to every log line.
+func (l *Logger) With(fields ...zap.Field) *Logger {
+	return &Logger{
+		logger:      l.logger.With(fields...),
+		debugLogger: l.debugLogger.With(fields...),
+		subsystems:  l.subsystems,
+	}
+}
+
+// WithSubsystem returns a logger scoped to the given subsystem, which logs
+// at debug if the subsystem was enabled via '--log.subsystems'.
+func (l *Logger) WithSubsystem(subsystem string) *Logger {
+	logger := l.logger
+	if _, ok := l.subsystems[subsystem]; ok {
+		logger = l.debugLogger
+	}
+	return &Logger{
+		logger:      logger.With(zap.String("subsystem", subsystem)),
+		debugLogger: l.debugLogger.With(zap.String("subsystem", subsystem)),
+		subsystems:  l.subsystems,
+	}
+}
@@ -0,0 +1,134 @@
+package nat
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	natPMPVersion         = 0
+	natPMPOpExternalAddr  = 0
+	natPMPOpMapUDP        = 1
+	natPMPOpMapTCP        = 2
+	natPMPResultSuccess   = 0
+	natPMPDefaultLifetime = 2 * time.Hour
+	natPMPRequestTimeout  = 2 * time.Second
+)
+
+// natPMPProvider discovers the gateway's external address and installs a
+// port mapping using NAT-PMP (RFC 6886), as implemented by most consumer
+// routers and Apple's AirPort/Time Capsule line.
+type natPMPProvider struct {
+	gatewayAddr string // host only, port is fixed at 5351.
+}
+
+// NATPMP returns a Provider that speaks NAT-PMP to the given gateway
+// (typically the default route's address).
+func NATPMP(gatewayAddr string) Provider {
+	return &natPMPProvider{gatewayAddr: gatewayAddr}
+}
+
+func (p *natPMPProvider) Name() string {
+	return "nat-pmp"
+}
+
+func (p *natPMPProvider) Map(ctx context.Context, proto Protocol, internalPort uint16) (Mapping, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(p.gatewayAddr, "5351"))
+	if err != nil {
+		return Mapping{}, fmt.Errorf("%w: dial gateway: %s", ErrNotAvailable, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(natPMPRequestTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	extAddr, err := p.externalAddr(conn)
+	if err != nil {
+		return Mapping{}, err
+	}
+
+	op := byte(natPMPOpMapUDP)
+	if proto == TCP {
+		op = natPMPOpMapTCP
+	}
+
+	req := make([]byte, 12)
+	req[0] = natPMPVersion
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], internalPort)
+	binary.BigEndian.PutUint16(req[6:8], internalPort)
+	binary.BigEndian.PutUint32(req[8:12], uint32(natPMPDefaultLifetime.Seconds()))
+
+	if _, err := conn.Write(req); err != nil {
+		return Mapping{}, fmt.Errorf("%w: write map request: %s", ErrNotAvailable, err)
+	}
+
+	resp := make([]byte, 16)
+	n, err := conn.Read(resp)
+	if err != nil || n < 16 {
+		return Mapping{}, fmt.Errorf("%w: read map response: %s", ErrNotAvailable, err)
+	}
+	if result := binary.BigEndian.Uint16(resp[2:4]); result != natPMPResultSuccess {
+		return Mapping{}, fmt.Errorf("%w: gateway returned result %d", ErrNotAvailable, result)
+	}
+
+	externalPort := binary.BigEndian.Uint16(resp[10:12])
+	lifetime := time.Duration(binary.BigEndian.Uint32(resp[12:16])) * time.Second
+
+	return Mapping{
+		ExternalAddr: netip.AddrPortFrom(extAddr, externalPort),
+		Lifetime:     lifetime,
+	}, nil
+}
+
+func (p *natPMPProvider) Unmap(ctx context.Context, proto Protocol, internalPort uint16) error {
+	conn, err := net.Dial("udp", net.JoinHostPort(p.gatewayAddr, "5351"))
+	if err != nil {
+		return fmt.Errorf("%w: dial gateway: %s", ErrNotAvailable, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(natPMPRequestTimeout))
+
+	op := byte(natPMPOpMapUDP)
+	if proto == TCP {
+		op = natPMPOpMapTCP
+	}
+
+	// A mapping lifetime of zero tells the gateway to remove the mapping.
+	req := make([]byte, 12)
+	req[0] = natPMPVersion
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], internalPort)
+
+	_, err = conn.Write(req)
+	return err
+}
+
+func (p *natPMPProvider) externalAddr(conn net.Conn) (netip.Addr, error) {
+	req := []byte{natPMPVersion, natPMPOpExternalAddr}
+	if _, err := conn.Write(req); err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: write external addr request: %s", ErrNotAvailable, err)
+	}
+
+	resp := make([]byte, 12)
+	n, err := conn.Read(resp)
+	if err != nil || n < 12 {
+		return netip.Addr{}, fmt.Errorf("%w: read external addr response: %s", ErrNotAvailable, err)
+	}
+	if result := binary.BigEndian.Uint16(resp[2:4]); result != natPMPResultSuccess {
+		return netip.Addr{}, fmt.Errorf("%w: gateway returned result %d", ErrNotAvailable, result)
+	}
+
+	addr, ok := netip.AddrFromSlice(resp[8:12])
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("%w: invalid external addr in response", ErrNotAvailable)
+	}
+	return addr, nil
+}
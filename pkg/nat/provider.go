@@ -0,0 +1,61 @@
+// Package nat discovers an externally-reachable address for a locally
+// bound port and keeps any required port mapping refreshed, so nodes behind
+// NAT (home labs, edge PoPs, multi-region deployments with distinct
+// internal/external addresses) can still be reached by the rest of the
+// cluster.
+//
+// The design mirrors syncthing's nat.Service: a chain of Provider
+// implementations is tried in order for each mapping, and the first to
+// succeed is used.
+package nat
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// ErrNotAvailable is returned by a Provider when it can't be used in the
+// current environment, such as no UPnP-capable gateway being reachable. The
+// Service falls through to the next configured provider.
+var ErrNotAvailable = errors.New("nat: provider not available")
+
+// Protocol is the transport protocol a mapping applies to.
+type Protocol string
+
+const (
+	TCP Protocol = "tcp"
+	UDP Protocol = "udp"
+)
+
+// Mapping is an externally-reachable address mapped to a local port.
+type Mapping struct {
+	// ExternalAddr is the address the rest of the cluster should use to
+	// reach the local port.
+	ExternalAddr netip.AddrPort
+	// Lifetime is how long the mapping is valid for before it must be
+	// refreshed, or zero if the mapping doesn't expire (such as a static
+	// override).
+	Lifetime time.Duration
+}
+
+// Provider discovers an external address for a local port and, where the
+// underlying mechanism requires it, installs a port mapping to make it
+// reachable.
+//
+// Implementations must be safe for concurrent use.
+type Provider interface {
+	// Name identifies the provider in logs, such as "static", "upnp",
+	// "nat-pmp" or "stun".
+	Name() string
+
+	// Map requests an external address for internalPort, returning
+	// ErrNotAvailable if this provider can't be used.
+	Map(ctx context.Context, proto Protocol, internalPort uint16) (Mapping, error)
+
+	// Unmap releases a previously installed mapping. It's a no-op for
+	// providers that don't install state (such as STUN or a static
+	// override).
+	Unmap(ctx context.Context, proto Protocol, internalPort uint16) error
+}
@@ -0,0 +1,198 @@
+package nat
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"go.uber.org/zap"
+)
+
+// refreshMargin is how long before a mapping's lease expires the Service
+// attempts to refresh it, to tolerate the refresh itself taking time or
+// briefly failing.
+const refreshMargin = 30 * time.Second
+
+// mappingRequest is a local port the Service should keep externally
+// reachable.
+type mappingRequest struct {
+	proto        Protocol
+	internalPort uint16
+}
+
+// Service discovers and maintains an external address for one or more local
+// ports, trying each configured Provider in turn and refreshing the winning
+// mapping before its lease expires.
+//
+// The discovered address for a port is pushed to subscribers via a size-1
+// coalescing channel (mirroring pkg/ifacewatch), so a provider flapping
+// doesn't queue up a backlog of updates.
+type Service struct {
+	providers      []Provider
+	releaseTimeout time.Duration
+
+	mu          sync.Mutex
+	mappedBy    map[mappingRequest]Provider
+	subscribers map[mappingRequest][]chan netip.AddrPort
+
+	logger *log.Logger
+}
+
+// NewService creates a NAT service that tries providers in order for each
+// requested mapping.
+//
+// releaseTimeout bounds how long Keep will wait for a provider to release a
+// mapping on shutdown, since by the time release runs the ctx passed to Keep
+// is already cancelled and so can't itself be used to bound the release
+// call.
+func NewService(providers []Provider, releaseTimeout time.Duration, logger *log.Logger) *Service {
+	return &Service{
+		providers:      providers,
+		releaseTimeout: releaseTimeout,
+		mappedBy:       make(map[mappingRequest]Provider),
+		subscribers:    make(map[mappingRequest][]chan netip.AddrPort),
+		logger:         logger,
+	}
+}
+
+// Subscribe returns a channel that receives the external address for the
+// given local port whenever it's (re)discovered or changes. Must be called
+// before Keep.
+func (s *Service) Subscribe(proto Protocol, internalPort uint16) <-chan netip.AddrPort {
+	req := mappingRequest{proto: proto, internalPort: internalPort}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan netip.AddrPort, 1)
+	s.subscribers[req] = append(s.subscribers[req], ch)
+	return ch
+}
+
+// Keep maintains a mapping for the given local port until ctx is cancelled,
+// at which point any installed mapping is released.
+//
+// It blocks, so should be run in its own goroutine per port.
+func (s *Service) Keep(ctx context.Context, proto Protocol, internalPort uint16) error {
+	req := mappingRequest{proto: proto, internalPort: internalPort}
+
+	for {
+		mapping, provider, err := s.mapOnce(ctx, req)
+		if err != nil {
+			s.logger.Warn(
+				"failed to map port with any nat provider",
+				zap.String("proto", string(proto)),
+				zap.Uint16("internal_port", internalPort),
+				zap.Error(err),
+			)
+			if !sleep(ctx, refreshInterval(0)) {
+				return s.releaseIfMapped(req)
+			}
+			continue
+		}
+
+		s.notify(req, mapping.ExternalAddr)
+
+		wait := refreshInterval(mapping.Lifetime)
+		if !sleep(ctx, wait) {
+			return s.release(req, provider)
+		}
+	}
+}
+
+func (s *Service) mapOnce(ctx context.Context, req mappingRequest) (Mapping, Provider, error) {
+	var lastErr error
+	for _, provider := range s.providers {
+		mapping, err := provider.Map(ctx, req.proto, req.internalPort)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		s.mu.Lock()
+		s.mappedBy[req] = provider
+		s.mu.Unlock()
+
+		s.logger.Debug(
+			"mapped port",
+			zap.String("provider", provider.Name()),
+			zap.String("external_addr", mapping.ExternalAddr.String()),
+		)
+		return mapping, provider, nil
+	}
+	return Mapping{}, nil, lastErr
+}
+
+// release unmaps req via provider. The ctx passed to Keep is already
+// cancelled by the time this runs, so it can't be used to bound the Unmap
+// call; instead derive a fresh context bounded by releaseTimeout so
+// providers doing ctx-bound I/O (such as the UPnP provider's SOAP calls)
+// get a real chance to release the mapping within the server's grace
+// period.
+func (s *Service) release(req mappingRequest, provider Provider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.releaseTimeout)
+	defer cancel()
+
+	if err := provider.Unmap(ctx, req.proto, req.internalPort); err != nil {
+		s.logger.Warn("failed to release nat mapping", zap.Error(err))
+	}
+	s.mu.Lock()
+	delete(s.mappedBy, req)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) releaseIfMapped(req mappingRequest) error {
+	s.mu.Lock()
+	provider, ok := s.mappedBy[req]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.release(req, provider)
+}
+
+func (s *Service) notify(req mappingRequest, addr netip.AddrPort) {
+	s.mu.Lock()
+	subs := s.subscribers[req]
+	s.mu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- addr:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- addr
+		}
+	}
+}
+
+// refreshInterval returns how long to wait before the next map attempt,
+// refreshing well before a mapping's lease would otherwise expire.
+func refreshInterval(lifetime time.Duration) time.Duration {
+	if lifetime <= 0 {
+		return 5 * time.Minute
+	}
+	if lifetime <= refreshMargin {
+		return lifetime / 2
+	}
+	return lifetime - refreshMargin
+}
+
+// sleep waits for d or ctx cancellation, returning false if ctx was
+// cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
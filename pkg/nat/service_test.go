@@ -0,0 +1,100 @@
+package nat
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	name      string
+	mapping   Mapping
+	mapErr    error
+	unmapped  bool
+	unmapErr  error
+	honorsCtx bool
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Map(context.Context, Protocol, uint16) (Mapping, error) {
+	if p.mapErr != nil {
+		return Mapping{}, p.mapErr
+	}
+	return p.mapping, nil
+}
+
+func (p *fakeProvider) Unmap(ctx context.Context, _ Protocol, _ uint16) error {
+	if p.honorsCtx && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	p.unmapped = true
+	return p.unmapErr
+}
+
+func TestService_FallsThroughUnavailableProviders(t *testing.T) {
+	unavailable := &fakeProvider{name: "upnp", mapErr: ErrNotAvailable}
+	static := &fakeProvider{
+		name: "static",
+		mapping: Mapping{
+			ExternalAddr: netip.MustParseAddrPort("203.0.113.10:8000"),
+		},
+	}
+
+	svc := NewService([]Provider{unavailable, static}, time.Second, log.NewNopLogger())
+	updates := svc.Subscribe(TCP, 8000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- svc.Keep(ctx, TCP, 8000) }()
+
+	select {
+	case addr := <-updates:
+		assert.Equal(t, "203.0.113.10:8000", addr.String())
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for mapping")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.True(t, static.unmapped)
+	assert.False(t, unavailable.unmapped)
+}
+
+// TestService_ReleaseUsesFreshContext ensures the ctx passed to a provider's
+// Unmap on shutdown is not the already-cancelled ctx given to Keep, since
+// providers doing ctx-bound I/O (such as UPnP's SOAP calls) would otherwise
+// abort the release immediately with "context canceled".
+func TestService_ReleaseUsesFreshContext(t *testing.T) {
+	provider := &fakeProvider{
+		name: "static",
+		mapping: Mapping{
+			ExternalAddr: netip.MustParseAddrPort("203.0.113.10:8000"),
+		},
+		honorsCtx: true,
+	}
+
+	svc := NewService([]Provider{provider}, time.Second, log.NewNopLogger())
+	updates := svc.Subscribe(TCP, 8000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- svc.Keep(ctx, TCP, 8000) }()
+
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for mapping")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.True(t, provider.unmapped)
+}
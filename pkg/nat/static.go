@@ -0,0 +1,33 @@
+package nat
+
+import (
+	"context"
+	"net/netip"
+)
+
+// staticProvider always advertises a fixed, operator-configured external
+// host, for deployments where the externally-reachable address is known up
+// front (such as a cloud load balancer or a manually configured 1:1 port
+// forward) and discovery would be unnecessary or unreliable. The external
+// port is assumed to match the internal port.
+type staticProvider struct {
+	host netip.Addr
+}
+
+// Static returns a Provider that always advertises the given external host,
+// assuming the external port matches the requested internal port.
+func Static(host netip.Addr) Provider {
+	return &staticProvider{host: host}
+}
+
+func (p *staticProvider) Name() string {
+	return "static"
+}
+
+func (p *staticProvider) Map(_ context.Context, _ Protocol, internalPort uint16) (Mapping, error) {
+	return Mapping{ExternalAddr: netip.AddrPortFrom(p.host, internalPort)}, nil
+}
+
+func (p *staticProvider) Unmap(_ context.Context, _ Protocol, _ uint16) error {
+	return nil
+}
@@ -0,0 +1,187 @@
+package nat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+const (
+	stunMagicCookie      uint32 = 0x2112A442
+	stunBindingRequest   uint16 = 0x0001
+	stunBindingResponse  uint16 = 0x0101
+	stunXorMappedAddress uint16 = 0x0020
+	stunMappedAddress    uint16 = 0x0001
+)
+
+// stunProvider discovers the external address of the local UDP socket by
+// sending a STUN (RFC 5389) binding request to a public STUN server and
+// reading back the XOR-MAPPED-ADDRESS (falling back to MAPPED-ADDRESS for
+// older servers) from the response.
+//
+// STUN only discovers an external address; it can't install a port mapping,
+// so it's only useful where the NAT already maps the external port 1:1 to
+// the internal port (such as many home routers in 'full cone' mode), or
+// combined with an explicit '--nat.static-ext-addr' override.
+type stunProvider struct {
+	serverAddr string
+}
+
+// STUN returns a Provider that discovers the external address via the given
+// STUN server (host:port).
+func STUN(serverAddr string) Provider {
+	return &stunProvider{serverAddr: serverAddr}
+}
+
+func (p *stunProvider) Name() string {
+	return "stun"
+}
+
+func (p *stunProvider) Map(ctx context.Context, _ Protocol, internalPort uint16) (Mapping, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: int(internalPort)})
+	if err != nil {
+		return Mapping{}, fmt.Errorf("%w: listen: %s", ErrNotAvailable, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	serverAddr, err := net.ResolveUDPAddr("udp", p.serverAddr)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("%w: resolve stun server: %s", ErrNotAvailable, err)
+	}
+
+	txID := make([]byte, 12)
+	if _, err := rand.Read(txID); err != nil {
+		return Mapping{}, err
+	}
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(req[2:4], 0)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	copy(req[8:20], txID)
+
+	if _, err := conn.WriteToUDP(req, serverAddr); err != nil {
+		return Mapping{}, fmt.Errorf("%w: write request: %s", ErrNotAvailable, err)
+	}
+
+	resp := make([]byte, 512)
+	n, _, err := conn.ReadFromUDP(resp)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("%w: read response: %s", ErrNotAvailable, err)
+	}
+
+	addr, err := parseStunBindingResponse(resp[:n], txID)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("%w: %s", ErrNotAvailable, err)
+	}
+	// The STUN request is sent over UDP regardless of proto, so addr.Port()
+	// is the NAT's external UDP mapping for internalPort, not necessarily
+	// the external port serving proto. Since STUN can't install a mapping
+	// at all, callers are already relying on the NAT mapping the external
+	// port straight through to internalPort (see the 1:1 NAT assumption in
+	// the doc comment above), so pair the discovered IP with internalPort
+	// rather than advertise the UDP mapping's port.
+	return Mapping{
+		ExternalAddr: netip.AddrPortFrom(addr.Addr(), internalPort),
+	}, nil
+}
+
+func (p *stunProvider) Unmap(context.Context, Protocol, uint16) error {
+	// STUN doesn't install any mapping state to release.
+	return nil
+}
+
+func parseStunBindingResponse(data, txID []byte) (netip.AddrPort, error) {
+	if len(data) < 20 {
+		return netip.AddrPort{}, fmt.Errorf("response too short")
+	}
+	msgType := binary.BigEndian.Uint16(data[0:2])
+	if msgType != stunBindingResponse {
+		return netip.AddrPort{}, fmt.Errorf("unexpected message type 0x%04x", msgType)
+	}
+	msgLen := binary.BigEndian.Uint16(data[2:4])
+	if int(msgLen)+20 > len(data) {
+		return netip.AddrPort{}, fmt.Errorf("truncated response")
+	}
+	if string(data[8:20]) != string(txID) {
+		return netip.AddrPort{}, fmt.Errorf("transaction ID mismatch")
+	}
+
+	attrs := data[20 : 20+msgLen]
+	var mapped, xorMapped netip.AddrPort
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := binary.BigEndian.Uint16(attrs[2:4])
+		if int(attrLen)+4 > len(attrs) {
+			break
+		}
+		val := attrs[4 : 4+attrLen]
+
+		switch attrType {
+		case stunXorMappedAddress:
+			if addr, ok := decodeXorMappedAddress(val); ok {
+				xorMapped = addr
+			}
+		case stunMappedAddress:
+			if addr, ok := decodeMappedAddress(val); ok {
+				mapped = addr
+			}
+		}
+
+		// Attributes are padded to a multiple of 4 bytes.
+		advance := 4 + int(attrLen)
+		if pad := advance % 4; pad != 0 {
+			advance += 4 - pad
+		}
+		if advance > len(attrs) {
+			break
+		}
+		attrs = attrs[advance:]
+	}
+
+	if xorMapped.IsValid() {
+		return xorMapped, nil
+	}
+	if mapped.IsValid() {
+		return mapped, nil
+	}
+	return netip.AddrPort{}, fmt.Errorf("no mapped address attribute in response")
+}
+
+func decodeMappedAddress(val []byte) (netip.AddrPort, bool) {
+	if len(val) < 8 || val[1] != 0x01 {
+		return netip.AddrPort{}, false
+	}
+	port := binary.BigEndian.Uint16(val[2:4])
+	addr, ok := netip.AddrFromSlice(val[4:8])
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr, port), true
+}
+
+func decodeXorMappedAddress(val []byte) (netip.AddrPort, bool) {
+	if len(val) < 8 || val[1] != 0x01 {
+		return netip.AddrPort{}, false
+	}
+	port := binary.BigEndian.Uint16(val[2:4]) ^ uint16(stunMagicCookie>>16)
+	var cookie [4]byte
+	binary.BigEndian.PutUint32(cookie[:], stunMagicCookie)
+
+	ipBytes := make([]byte, 4)
+	for i := 0; i < 4; i++ {
+		ipBytes[i] = val[4+i] ^ cookie[i]
+	}
+	addr, ok := netip.AddrFromSlice(ipBytes)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr, port), true
+}
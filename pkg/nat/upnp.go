@@ -0,0 +1,283 @@
+package nat
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	upnpSSDPAddr       = "239.255.255.250:1900"
+	upnpSearchTarget   = "urn:schemas-upnp-org:service:WANIPConnection:1"
+	upnpSearchTimeout  = 2 * time.Second
+	upnpSOAPActionNS   = "urn:schemas-upnp-org:service:WANIPConnection:1"
+)
+
+// upnpProvider discovers an Internet Gateway Device on the local network via
+// SSDP and installs a port mapping using its WANIPConnection SOAP service.
+type upnpProvider struct {
+	httpClient *http.Client
+}
+
+// UPnP returns a Provider that discovers a UPnP-IGD gateway on the local
+// network.
+func UPnP() Provider {
+	return &upnpProvider{httpClient: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (p *upnpProvider) Name() string {
+	return "upnp"
+}
+
+func (p *upnpProvider) Map(ctx context.Context, proto Protocol, internalPort uint16) (Mapping, error) {
+	controlURL, err := p.discover(ctx)
+	if err != nil {
+		return Mapping{}, err
+	}
+
+	extIP, err := p.getExternalIP(ctx, controlURL)
+	if err != nil {
+		return Mapping{}, err
+	}
+
+	if err := p.addPortMapping(ctx, controlURL, proto, internalPort, internalPort); err != nil {
+		return Mapping{}, err
+	}
+
+	return Mapping{
+		ExternalAddr: netip.AddrPortFrom(extIP, internalPort),
+		// Most IGDs don't report a lease duration for indefinite mappings;
+		// refresh conservatively.
+		Lifetime: time.Hour,
+	}, nil
+}
+
+func (p *upnpProvider) Unmap(ctx context.Context, proto Protocol, internalPort uint16) error {
+	controlURL, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+	return p.deletePortMapping(ctx, controlURL, proto, internalPort)
+}
+
+// discover locates an IGD's WANIPConnection control URL via SSDP, falling
+// back to ErrNotAvailable if none responds (such as no UPnP-capable gateway,
+// or UPnP disabled on the router).
+func (p *upnpProvider) discover(ctx context.Context) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", fmt.Errorf("%w: listen: %s", ErrNotAvailable, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(upnpSearchTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	ssdpAddr, err := net.ResolveUDPAddr("udp4", upnpSSDPAddr)
+	if err != nil {
+		return "", fmt.Errorf("%w: resolve ssdp addr: %s", ErrNotAvailable, err)
+	}
+
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + upnpSSDPAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + upnpSearchTarget + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(req), ssdpAddr); err != nil {
+		return "", fmt.Errorf("%w: write m-search: %s", ErrNotAvailable, err)
+	}
+
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		return "", fmt.Errorf("%w: no ssdp response: %s", ErrNotAvailable, err)
+	}
+
+	location := parseSSDPLocation(string(buf[:n]))
+	if location == "" {
+		return "", fmt.Errorf("%w: ssdp response missing LOCATION", ErrNotAvailable)
+	}
+
+	return p.fetchControlURL(ctx, location)
+}
+
+var ssdpLocationRe = regexp.MustCompile(`(?i)LOCATION:\s*(\S+)`)
+
+func parseSSDPLocation(resp string) string {
+	m := ssdpLocationRe.FindStringSubmatch(resp)
+	if len(m) != 2 {
+		return ""
+	}
+	return strings.TrimSpace(m[1])
+}
+
+// upnpDevice is a (heavily trimmed) subset of a UPnP device description
+// document, just enough to find the WANIPConnection control URL.
+type upnpDevice struct {
+	Device struct {
+		ServiceList struct {
+			Services []upnpService `xml:"service"`
+		} `xml:"serviceList"`
+		DeviceList struct {
+			Devices []struct {
+				DeviceList struct {
+					Devices []struct {
+						ServiceList struct {
+							Services []upnpService `xml:"service"`
+						} `xml:"serviceList"`
+					} `xml:"device"`
+				} `xml:"deviceList"`
+			} `xml:"device"`
+		} `xml:"deviceList"`
+	} `xml:"device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+func (p *upnpProvider) fetchControlURL(ctx context.Context, descURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, descURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: fetch device description: %s", ErrNotAvailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var dev upnpDevice
+	if err := xml.Unmarshal(body, &dev); err != nil {
+		return "", fmt.Errorf("%w: parse device description: %s", ErrNotAvailable, err)
+	}
+
+	var services []upnpService
+	services = append(services, dev.Device.ServiceList.Services...)
+	for _, d := range dev.Device.DeviceList.Devices {
+		for _, d2 := range d.DeviceList.Devices {
+			services = append(services, d2.ServiceList.Services...)
+		}
+	}
+
+	for _, s := range services {
+		if s.ServiceType == upnpSearchTarget {
+			base := descURL
+			if idx := strings.Index(descURL[len("http://"):], "/"); idx >= 0 {
+				base = descURL[:len("http://")+idx]
+			}
+			if strings.HasPrefix(s.ControlURL, "/") {
+				return base + s.ControlURL, nil
+			}
+			return s.ControlURL, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no WANIPConnection service found", ErrNotAvailable)
+}
+
+func (p *upnpProvider) soapCall(ctx context.Context, controlURL, action, body string) (string, error) {
+	envelope := `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body>` + body + `</s:Body>
+</s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, strings.NewReader(envelope))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, upnpSOAPActionNS, action))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: soap request: %s", ErrNotAvailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: soap request returned status %d", ErrNotAvailable, resp.StatusCode)
+	}
+	return string(respBody), nil
+}
+
+func (p *upnpProvider) getExternalIP(ctx context.Context, controlURL string) (netip.Addr, error) {
+	body := fmt.Sprintf(
+		`<u:GetExternalIPAddress xmlns:u="%s"></u:GetExternalIPAddress>`,
+		upnpSOAPActionNS,
+	)
+	resp, err := p.soapCall(ctx, controlURL, "GetExternalIPAddress", body)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	re := regexp.MustCompile(`<NewExternalIPAddress>([^<]+)</NewExternalIPAddress>`)
+	m := re.FindStringSubmatch(resp)
+	if len(m) != 2 {
+		return netip.Addr{}, fmt.Errorf("%w: no external ip in response", ErrNotAvailable)
+	}
+	addr, err := netip.ParseAddr(m[1])
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: invalid external ip: %s", ErrNotAvailable, err)
+	}
+	return addr, nil
+}
+
+func (p *upnpProvider) addPortMapping(ctx context.Context, controlURL string, proto Protocol, externalPort, internalPort uint16) error {
+	body := fmt.Sprintf(`<u:AddPortMapping xmlns:u="%s">
+<NewRemoteHost></NewRemoteHost>
+<NewExternalPort>%d</NewExternalPort>
+<NewProtocol>%s</NewProtocol>
+<NewInternalPort>%d</NewInternalPort>
+<NewInternalClient>%s</NewInternalClient>
+<NewEnabled>1</NewEnabled>
+<NewPortMappingDescription>piko</NewPortMappingDescription>
+<NewLeaseDuration>0</NewLeaseDuration>
+</u:AddPortMapping>`, upnpSOAPActionNS, externalPort, strings.ToUpper(string(proto)), internalPort, localAddrHint())
+
+	_, err := p.soapCall(ctx, controlURL, "AddPortMapping", body)
+	return err
+}
+
+func (p *upnpProvider) deletePortMapping(ctx context.Context, controlURL string, proto Protocol, externalPort uint16) error {
+	body := fmt.Sprintf(`<u:DeletePortMapping xmlns:u="%s">
+<NewRemoteHost></NewRemoteHost>
+<NewExternalPort>%d</NewExternalPort>
+<NewProtocol>%s</NewProtocol>
+</u:DeletePortMapping>`, upnpSOAPActionNS, externalPort, strings.ToUpper(string(proto)))
+
+	_, err := p.soapCall(ctx, controlURL, "DeletePortMapping", body)
+	return err
+}
+
+// localAddrHint best-effort determines the local address to advertise to
+// the gateway as the mapping's internal client, by opening a UDP "connection"
+// to a public address without sending any traffic.
+func localAddrHint() string {
+	conn, err := net.Dial("udp4", "203.0.113.1:80")
+	if err != nil {
+		return "0.0.0.0"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
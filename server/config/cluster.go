@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ClusterConfig contains configuration for the cluster of Pico server
+// nodes.
+type ClusterConfig struct {
+	Members []string
+
+	// AdvertiseCIDRs is an ordered list of CIDR ranges used to choose which
+	// local IP to advertise to the cluster when a listen address binds to
+	// all interfaces (such as '0.0.0.0' or '::'). The first non-loopback
+	// address matching an entry wins; if none match, or the list is empty,
+	// an arbitrary usable address is chosen.
+	AdvertiseCIDRs []string
+
+	// JoinTimeoutSeconds is the maximum number of seconds to wait for the
+	// node to join the cluster and complete its initial sync during
+	// startup, before giving up.
+	JoinTimeoutSeconds int
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *ClusterConfig) Validate() error {
+	for _, cidr := range c.AdvertiseCIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("advertise cidr %q: %w", cidr, err)
+		}
+	}
+	if c.JoinTimeoutSeconds <= 0 {
+		return fmt.Errorf("join-timeout-seconds must be greater than 0")
+	}
+	return nil
+}
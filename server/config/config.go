@@ -0,0 +1,69 @@
+// Package config contains the configuration for the Pico server node.
+package config
+
+import "fmt"
+
+// Config is the configuration for a Pico server node.
+type Config struct {
+	Server   ServerConfig
+	Cluster  ClusterConfig
+	Proxy    ProxyConfig
+	Upstream UpstreamConfig
+	NAT      NATConfig
+	Log      LogConfig
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *Config) Validate() error {
+	if c.Server.ListenAddr == "" {
+		return fmt.Errorf("server.listen-addr must be set")
+	}
+	if c.Server.GossipAddr == "" {
+		return fmt.Errorf("server.gossip-addr must be set")
+	}
+	if c.Server.AdminListenAddr == "" {
+		return fmt.Errorf("server.admin-listen-addr must be set")
+	}
+	if c.Server.GracePeriodSeconds <= 0 {
+		return fmt.Errorf("server.grace-period-seconds must be greater than 0")
+	}
+	if c.Proxy.TimeoutSeconds <= 0 {
+		return fmt.Errorf("proxy.timeout-seconds must be greater than 0")
+	}
+	if c.Upstream.HeartbeatIntervalSeconds <= 0 {
+		return fmt.Errorf("upstream.heartbeat-interval-seconds must be greater than 0")
+	}
+	if c.Upstream.HeartbeatTimeoutSeconds <= 0 {
+		return fmt.Errorf("upstream.heartbeat-timeout-seconds must be greater than 0")
+	}
+	if err := c.Cluster.Validate(); err != nil {
+		return fmt.Errorf("cluster: %w", err)
+	}
+	return nil
+}
+
+// ServerConfig contains configuration for serving client and upstream
+// traffic.
+type ServerConfig struct {
+	ListenAddr         string
+	GossipAddr         string
+	AdminListenAddr    string
+	GracePeriodSeconds int
+}
+
+// ProxyConfig contains configuration for proxying traffic to upstreams.
+type ProxyConfig struct {
+	TimeoutSeconds int
+}
+
+// UpstreamConfig contains configuration for upstream listener connections.
+type UpstreamConfig struct {
+	HeartbeatIntervalSeconds int
+	HeartbeatTimeoutSeconds  int
+}
+
+// LogConfig contains configuration for logging.
+type LogConfig struct {
+	Level      string
+	Subsystems []string
+}
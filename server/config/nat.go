@@ -0,0 +1,28 @@
+package config
+
+// NATConfig contains configuration for discovering an externally-reachable
+// address for this node, for deployments where cluster members sit behind
+// NAT or otherwise have distinct internal/external addresses.
+type NATConfig struct {
+	// Enabled turns on NAT traversal. Disabled by default since most
+	// deployments (such as a Kubernetes cluster) gossip directly reachable
+	// addresses already.
+	Enabled bool
+
+	// StaticExtAddr, if set, is used as the external address instead of
+	// running discovery, such as '203.0.113.10' for a node with a manually
+	// configured port forward.
+	StaticExtAddr string
+
+	// STUNServerAddr is the STUN server used to discover the external
+	// address when UPnP/NAT-PMP aren't available.
+	STUNServerAddr string
+
+	// NATPMPGatewayAddr, if set, is used to contact the gateway via NAT-PMP
+	// instead of the default route.
+	NATPMPGatewayAddr string
+
+	// DisableUPnP turns off UPnP-IGD discovery, such as where it's known
+	// to be unsupported or disabled on the network.
+	DisableUPnP bool
+}
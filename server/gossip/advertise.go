@@ -0,0 +1,55 @@
+package gossip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// resolveAdvertiseAddr resolves a bind address (such as ':8000' or
+// '0.0.0.0:8000') to the address that should be advertised to the rest of
+// the cluster, given the host's current set of usable IPs.
+//
+// If the bind host is already a specific address (not unspecified), it's
+// returned unchanged, since there's nothing to resolve. Otherwise the first
+// address in addrs matching an entry in preferred wins; if none match, an
+// arbitrary address from addrs is used so the node still advertises
+// *something* usable.
+func resolveAdvertiseAddr(bindAddr string, addrs []netip.Addr, preferred []netip.Prefix) (string, error) {
+	host, port, err := net.SplitHostPort(bindAddr)
+	if err != nil {
+		return "", fmt.Errorf("split host port: %w", err)
+	}
+
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		// Already a specific address; nothing to resolve.
+		return bindAddr, nil
+	}
+
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no usable interface addresses")
+	}
+
+	for _, prefix := range preferred {
+		for _, addr := range addrs {
+			if prefix.Contains(addr) {
+				return net.JoinHostPort(addr.String(), port), nil
+			}
+		}
+	}
+
+	return net.JoinHostPort(addrs[0].String(), port), nil
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse cidr %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
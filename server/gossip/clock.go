@@ -0,0 +1,23 @@
+package gossip
+
+import "time"
+
+// Clock abstracts time so the syncer's periodic anti-entropy reconciler can
+// be driven deterministically in tests. The interface is a subset of
+// github.com/benbjohnson/clock.Clock, so a *clock.Mock satisfies it
+// directly.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,74 @@
+package gossip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/config"
+	"github.com/andydunstall/pico/server/netmap"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGossip_ReadyAfterJoin spins up two in-process nodes and asserts the
+// second only reports ready once it's observed the first join and
+// gossip its initial state. There's no real gossip transport in this tree
+// yet, so node A's state is fed into node B's syncer directly, the same
+// way the real transport would deliver it via OnJoin/OnUpsertKey.
+func TestGossip_ReadyAfterJoin(t *testing.T) {
+	confA := &config.Config{
+		Server: config.ServerConfig{
+			ListenAddr:      "10.26.104.1:8000",
+			AdminListenAddr: "10.26.104.1:8001",
+		},
+	}
+	nodeA := &netmap.Node{
+		ID:        netmap.GenerateNodeID(),
+		Status:    netmap.NodeStatusActive,
+		ProxyAddr: confA.Server.ListenAddr,
+		AdminAddr: confA.Server.AdminListenAddr,
+	}
+	nmA := netmap.NewNetworkMap(nodeA, log.NewNopLogger())
+	gossipA, err := NewGossip(nmA, confA, log.NewNopLogger())
+	assert.NoError(t, err)
+	// A single-node bootstrap, so node A is ready immediately.
+	assert.True(t, gossipA.IsReady())
+
+	// Node B is configured with a cluster member, so it must join and sync
+	// before it's ready.
+	confB := &config.Config{
+		Server: config.ServerConfig{
+			ListenAddr:      "10.26.104.2:8000",
+			AdminListenAddr: "10.26.104.2:8001",
+		},
+		Cluster: config.ClusterConfig{
+			Members: []string{confA.Server.ListenAddr},
+		},
+	}
+	nodeB := &netmap.Node{
+		ID:        netmap.GenerateNodeID(),
+		Status:    netmap.NodeStatusActive,
+		ProxyAddr: confB.Server.ListenAddr,
+		AdminAddr: confB.Server.AdminListenAddr,
+	}
+	nmB := netmap.NewNetworkMap(nodeB, log.NewNopLogger())
+	gossipB, err := NewGossip(nmB, confB, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	assert.False(t, gossipB.IsReady())
+
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, gossipB.Ready(timeoutCtx))
+
+	// Node B observes node A joining and gossiping its proxy/admin
+	// addresses.
+	local := nmA.LocalNode()
+	gossipB.syncer.OnJoin(local.ID)
+	gossipB.syncer.OnUpsertKey(local.ID, "proxy_addr", local.ProxyAddr)
+	gossipB.syncer.OnUpsertKey(local.ID, "admin_addr", local.AdminAddr)
+
+	assert.True(t, gossipB.IsReady())
+	assert.NoError(t, gossipB.Ready(context.Background()))
+}
@@ -0,0 +1,96 @@
+package gossip
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/pkg/nat"
+	"github.com/andydunstall/pico/server/netmap"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// natService is the subset of nat.Service the advertiser depends on, so
+// tests can inject a fake.
+type natService interface {
+	Subscribe(proto nat.Protocol, internalPort uint16) <-chan netip.AddrPort
+	Keep(ctx context.Context, proto nat.Protocol, internalPort uint16) error
+}
+
+// natAdvertiser keeps a local port externally reachable via NAT traversal
+// (STUN/UPnP/NAT-PMP/a static override) and gossips the discovered address
+// to the rest of the cluster as the node's *_ext_addr keys, so peers behind
+// distinct internal/external addresses can still route to it.
+type natAdvertiser struct {
+	networkMap *netmap.NetworkMap
+	syncer     *syncer
+
+	service natService
+
+	proxyPort uint16
+	adminPort uint16
+
+	proxyExtAddr string
+	adminExtAddr string
+
+	logger *log.Logger
+}
+
+func newNATAdvertiser(
+	networkMap *netmap.NetworkMap,
+	syncer *syncer,
+	service natService,
+	proxyPort, adminPort uint16,
+	logger *log.Logger,
+) *natAdvertiser {
+	return &natAdvertiser{
+		networkMap: networkMap,
+		syncer:     syncer,
+		service:    service,
+		proxyPort:  proxyPort,
+		adminPort:  adminPort,
+		logger:     logger,
+	}
+}
+
+// Run maintains NAT mappings for the proxy and admin ports, updating the
+// netmap and re-advertising whenever the discovered external address
+// changes, until ctx is cancelled.
+func (a *natAdvertiser) Run(ctx context.Context) error {
+	proxyUpdates := a.service.Subscribe(nat.TCP, a.proxyPort)
+	adminUpdates := a.service.Subscribe(nat.TCP, a.adminPort)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return a.service.Keep(ctx, nat.TCP, a.proxyPort) })
+	g.Go(func() error { return a.service.Keep(ctx, nat.TCP, a.adminPort) })
+	g.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case addr := <-proxyUpdates:
+				a.proxyExtAddr = addr.String()
+				a.onExtAddrsChanged()
+			case addr := <-adminUpdates:
+				a.adminExtAddr = addr.String()
+				a.onExtAddrsChanged()
+			}
+		}
+	})
+
+	return g.Wait()
+}
+
+func (a *natAdvertiser) onExtAddrsChanged() {
+	if !a.networkMap.UpdateLocalExtAddrs(a.proxyExtAddr, a.adminExtAddr) {
+		return
+	}
+
+	a.logger.Info(
+		"nat mapping changed; re-advertising external addrs",
+		zap.String("proxy_ext_addr", a.proxyExtAddr),
+		zap.String("admin_ext_addr", a.adminExtAddr),
+	)
+	a.syncer.ReadvertiseExt()
+}
@@ -0,0 +1,82 @@
+package gossip
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/pkg/nat"
+	"github.com/andydunstall/pico/server/netmap"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNATService struct {
+	proxyUpdates chan netip.AddrPort
+	adminUpdates chan netip.AddrPort
+}
+
+func newFakeNATService() *fakeNATService {
+	return &fakeNATService{
+		proxyUpdates: make(chan netip.AddrPort, 1),
+		adminUpdates: make(chan netip.AddrPort, 1),
+	}
+}
+
+func (s *fakeNATService) Subscribe(_ nat.Protocol, port uint16) <-chan netip.AddrPort {
+	if port == 8000 {
+		return s.proxyUpdates
+	}
+	return s.adminUpdates
+}
+
+func (s *fakeNATService) Keep(ctx context.Context, _ nat.Protocol, _ uint16) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestNATAdvertiser_OnMappingChange(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+	sync := newSyncer(m, realClock{}, log.NewNopLogger())
+
+	gossiper := &fakeGossiper{}
+	sync.Sync(gossiper)
+
+	service := newFakeNATService()
+	advertiser := newNATAdvertiser(m, sync, service, 8000, 8001, log.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- advertiser.Run(ctx) }()
+
+	service.proxyUpdates <- netip.MustParseAddrPort("203.0.113.10:8000")
+
+	assert.Eventually(t, func() bool {
+		return m.LocalNode().ProxyExtAddr == "203.0.113.10:8000"
+	}, time.Second, time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		for _, u := range gossiper.upserts {
+			if u.Key == "proxy_ext_addr" && u.Value == "203.0.113.10:8000" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+
+	node, ok := m.Node("local")
+	assert.True(t, ok)
+	assert.Equal(t, "203.0.113.10:8000", node.EffectiveProxyAddr())
+	assert.Equal(t, "10.26.104.56:8001", node.EffectiveAdminAddr())
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,102 @@
+package gossip
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/netmap"
+	"go.uber.org/zap"
+)
+
+// addrWatcher is the subset of ifacewatch.Watcher the readvertiser depends
+// on, so tests can inject a fake.
+type addrWatcher interface {
+	Subscribe() <-chan []netip.Addr
+	Run(ctx context.Context) error
+}
+
+// readvertiser watches the host's network interfaces and re-publishes the
+// local node's proxy/admin addresses whenever the set of usable IPs
+// changes, so stale addresses don't linger in the cluster after a DHCP
+// renewal, VPN up/down, or pod IP reshuffle.
+type readvertiser struct {
+	networkMap *netmap.NetworkMap
+	syncer     *syncer
+
+	watcher addrWatcher
+
+	proxyBindAddr string
+	adminBindAddr string
+	preferred     []netip.Prefix
+
+	logger *log.Logger
+}
+
+func newReadvertiser(
+	networkMap *netmap.NetworkMap,
+	syncer *syncer,
+	watcher addrWatcher,
+	proxyBindAddr, adminBindAddr string,
+	preferredCIDRs []string,
+	logger *log.Logger,
+) (*readvertiser, error) {
+	preferred, err := parsePrefixes(preferredCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readvertiser{
+		networkMap:    networkMap,
+		syncer:        syncer,
+		watcher:       watcher,
+		proxyBindAddr: proxyBindAddr,
+		adminBindAddr: adminBindAddr,
+		preferred:     preferred,
+		logger:        logger,
+	}, nil
+}
+
+// Run watches for interface changes and re-advertises the local node's
+// addresses until ctx is cancelled.
+func (r *readvertiser) Run(ctx context.Context) error {
+	updates := r.watcher.Subscribe()
+
+	g := make(chan error, 1)
+	go func() {
+		g <- r.watcher.Run(ctx)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return <-g
+		case addrs := <-updates:
+			r.onAddrsChanged(addrs)
+		}
+	}
+}
+
+func (r *readvertiser) onAddrsChanged(addrs []netip.Addr) {
+	proxyAddr, err := resolveAdvertiseAddr(r.proxyBindAddr, addrs, r.preferred)
+	if err != nil {
+		r.logger.Warn("failed to resolve proxy addr", zap.Error(err))
+		return
+	}
+	adminAddr, err := resolveAdvertiseAddr(r.adminBindAddr, addrs, r.preferred)
+	if err != nil {
+		r.logger.Warn("failed to resolve admin addr", zap.Error(err))
+		return
+	}
+
+	if !r.networkMap.UpdateLocalAddrs(proxyAddr, adminAddr) {
+		return
+	}
+
+	r.logger.Info(
+		"interfaces changed; re-advertising local addrs",
+		zap.String("proxy_addr", proxyAddr),
+		zap.String("admin_addr", adminAddr),
+	)
+	r.syncer.Readvertise()
+}
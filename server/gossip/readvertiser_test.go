@@ -0,0 +1,98 @@
+package gossip
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/netmap"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAddrWatcher struct {
+	updates chan []netip.Addr
+}
+
+func newFakeAddrWatcher() *fakeAddrWatcher {
+	return &fakeAddrWatcher{updates: make(chan []netip.Addr, 1)}
+}
+
+func (w *fakeAddrWatcher) Subscribe() <-chan []netip.Addr {
+	return w.updates
+}
+
+func (w *fakeAddrWatcher) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestReadvertiser_OnInterfaceChange(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+	sync := newSyncer(m, realClock{}, log.NewNopLogger())
+
+	gossiper := &fakeGossiper{}
+	sync.Sync(gossiper)
+
+	watcher := newFakeAddrWatcher()
+	r, err := newReadvertiser(
+		m, sync, watcher, ":8000", ":8001", nil, log.NewNopLogger(),
+	)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+
+	watcher.updates <- []netip.Addr{netip.MustParseAddr("10.26.104.99")}
+
+	assert.Eventually(t, func() bool {
+		node := m.LocalNode()
+		return node.ProxyAddr == "10.26.104.99:8000" && node.AdminAddr == "10.26.104.99:8001"
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(
+		t,
+		upsert{"admin_addr", "10.26.104.99:8001"},
+		gossiper.upserts[len(gossiper.upserts)-1],
+	)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestResolveAdvertiseAddr(t *testing.T) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("192.168.1.5"),
+		netip.MustParseAddr("10.26.104.56"),
+	}
+
+	t.Run("specific bind address is unchanged", func(t *testing.T) {
+		addr, err := resolveAdvertiseAddr("10.26.104.99:8000", addrs, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "10.26.104.99:8000", addr)
+	})
+
+	t.Run("unspecified bind uses preferred cidr", func(t *testing.T) {
+		preferred, err := parsePrefixes([]string{"10.26.104.0/24"})
+		assert.NoError(t, err)
+
+		addr, err := resolveAdvertiseAddr(":8000", addrs, preferred)
+		assert.NoError(t, err)
+		assert.Equal(t, "10.26.104.56:8000", addr)
+	})
+
+	t.Run("unspecified bind with no match falls back", func(t *testing.T) {
+		addr, err := resolveAdvertiseAddr("0.0.0.0:8000", addrs, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "192.168.1.5:8000", addr)
+	})
+}
@@ -0,0 +1,538 @@
+package gossip
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/netmap"
+	"go.uber.org/zap"
+)
+
+const (
+	keyProxyAddr      = "proxy_addr"
+	keyAdminAddr      = "admin_addr"
+	keyProxyExtAddr   = "proxy_ext_addr"
+	keyAdminExtAddr   = "admin_ext_addr"
+	endpointKeyPrefix = "endpoint:"
+
+	// reconcileInterval is how often the syncer walks the netmap and diffs
+	// it against the gossip layer's authoritative state for each remote
+	// node, to repair state missed due to dropped gossip messages.
+	reconcileInterval = 30 * time.Second
+
+	// pendingGracePeriod is how long a node may remain pending (joined but
+	// still missing proxy_addr/admin_addr) before it's dropped, to avoid
+	// leaking pending entries for nodes that join and immediately leave
+	// without ever completing their initial sync.
+	pendingGracePeriod = 2 * time.Minute
+)
+
+// gossiper is the subset of the gossip layer the syncer depends on, so tests
+// can inject a fake.
+type gossiper interface {
+	UpsertLocal(key, value string)
+	DeleteLocal(key string)
+
+	// SnapshotRemote returns the authoritative set of keys currently held
+	// for the given remote node, used by the anti-entropy reconciler. A nil
+	// map means the gossip layer can't yet answer for that node, in which
+	// case the reconciler leaves it alone rather than treating it as empty.
+	SnapshotRemote(nodeID string) map[string]string
+}
+
+// pendingNode accumulates state gossiped about a remote node that has
+// joined the cluster but hasn't yet reported all the fields required for it
+// to be considered active.
+type pendingNode struct {
+	joinedAt     time.Time
+	proxyAddr    string
+	adminAddr    string
+	proxyExtAddr string
+	adminExtAddr string
+	endpoints    map[string]int
+}
+
+func (n *pendingNode) ready() bool {
+	return n.proxyAddr != "" && n.adminAddr != ""
+}
+
+// syncer keeps the netmap in sync with the gossip layer: it publishes the
+// local node's state to gossip, and applies events from the gossip layer to
+// the local netmap view of the rest of the cluster.
+type syncer struct {
+	networkMap *netmap.NetworkMap
+
+	mu           sync.Mutex
+	gossip       gossiper
+	pending      map[string]*pendingNode
+	nodeLoggers  map[string]*log.Logger
+	onNodeActive []func(nodeID string)
+
+	clock  Clock
+	logger *log.Logger
+}
+
+func newSyncer(networkMap *netmap.NetworkMap, clock Clock, logger *log.Logger) *syncer {
+	s := &syncer{
+		networkMap:  networkMap,
+		pending:     make(map[string]*pendingNode),
+		nodeLoggers: make(map[string]*log.Logger),
+		clock:       clock,
+		logger:      logger,
+	}
+	networkMap.OnLocalEndpointUpdate(s.onLocalEndpointUpdate)
+	return s
+}
+
+// OnNodeActive registers a callback invoked whenever a remote node first
+// becomes active, i.e. has gossiped enough state (proxy_addr and
+// admin_addr) to be added to the netmap. Used by Gossip to detect the node
+// has joined and synced with at least one peer.
+func (s *syncer) OnNodeActive(f func(nodeID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onNodeActive = append(s.onNodeActive, f)
+}
+
+// Run periodically reconciles the netmap against the gossip layer's
+// authoritative state until ctx is cancelled.
+func (s *syncer) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.clock.After(reconcileInterval):
+			s.reconcile()
+		}
+	}
+}
+
+// reconcile walks each known remote node, repairing any keys the netmap has
+// missed (or still has but the gossip layer no longer does) due to dropped
+// gossip messages, and drops any pending node that's been incomplete for
+// longer than pendingGracePeriod.
+func (s *syncer) reconcile() {
+	s.mu.Lock()
+	gossip := s.gossip
+	s.mu.Unlock()
+
+	if gossip != nil {
+		for _, node := range s.networkMap.Nodes() {
+			if s.isLocal(node.ID) {
+				continue
+			}
+			s.reconcileNode(gossip, node)
+		}
+	}
+
+	s.reapStalePending()
+}
+
+func (s *syncer) reconcileNode(gossip gossiper, node *netmap.Node) {
+	remote := gossip.SnapshotRemote(node.ID)
+	if remote == nil {
+		return
+	}
+
+	local := nodeKeyValues(node)
+	for key, value := range remote {
+		if local[key] != value {
+			s.OnUpsertKey(node.ID, key, value)
+		}
+	}
+	for key := range local {
+		if _, ok := remote[key]; !ok {
+			s.OnDeleteKey(node.ID, key)
+		}
+	}
+}
+
+// nodeKeyValues returns the gossip keys the local syncer believes should be
+// set for node, to diff against the gossip layer's authoritative view.
+func nodeKeyValues(node *netmap.Node) map[string]string {
+	kvs := map[string]string{
+		keyProxyAddr: node.ProxyAddr,
+		keyAdminAddr: node.AdminAddr,
+	}
+	if node.ProxyExtAddr != "" {
+		kvs[keyProxyExtAddr] = node.ProxyExtAddr
+	}
+	if node.AdminExtAddr != "" {
+		kvs[keyAdminExtAddr] = node.AdminExtAddr
+	}
+	for endpointID, count := range node.Endpoints {
+		kvs[endpointKeyPrefix+endpointID] = strconv.Itoa(count)
+	}
+	return kvs
+}
+
+func (s *syncer) reapStalePending() {
+	deadline := s.clock.Now().Add(-pendingGracePeriod)
+
+	s.mu.Lock()
+	var expired []string
+	for nodeID, p := range s.pending {
+		if !p.ready() && p.joinedAt.Before(deadline) {
+			expired = append(expired, nodeID)
+		}
+	}
+	for _, nodeID := range expired {
+		delete(s.pending, nodeID)
+		delete(s.nodeLoggers, nodeID)
+	}
+	s.mu.Unlock()
+
+	for _, nodeID := range expired {
+		s.logger.Warn(
+			"dropping pending node that never completed its initial sync",
+			zap.String("node_id", nodeID),
+		)
+	}
+}
+
+// nodeLogger returns the child logger bound to nodeID, creating one (with
+// no addr bound yet) if the node hasn't been seen via OnJoin. Callers hold
+// no lock, so this takes s.mu itself.
+func (s *syncer) nodeLogger(nodeID string) *log.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodeLoggerLocked(nodeID)
+}
+
+func (s *syncer) nodeLoggerLocked(nodeID string) *log.Logger {
+	if logger, ok := s.nodeLoggers[nodeID]; ok {
+		return logger
+	}
+	logger := s.logger.With(
+		zap.String("node_id", nodeID),
+		zap.Time("joined_at", s.clock.Now()),
+	)
+	s.nodeLoggers[nodeID] = logger
+	return logger
+}
+
+// bindNodeAddr adds the node's gossiped addr to its child logger once known,
+// so every subsequent log line for the node carries it.
+func (s *syncer) bindNodeAddr(nodeID, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logger := s.nodeLoggerLocked(nodeID)
+	s.nodeLoggers[nodeID] = logger.With(zap.String("addr", addr))
+}
+
+// Sync publishes the full local node state to the gossip layer. Must be
+// called once gossip has started.
+func (s *syncer) Sync(gossip gossiper) {
+	s.mu.Lock()
+	s.gossip = gossip
+	s.mu.Unlock()
+
+	local := s.networkMap.LocalNode()
+	gossip.UpsertLocal(keyProxyAddr, local.ProxyAddr)
+	gossip.UpsertLocal(keyAdminAddr, local.AdminAddr)
+	if local.ProxyExtAddr != "" {
+		gossip.UpsertLocal(keyProxyExtAddr, local.ProxyExtAddr)
+	}
+	if local.AdminExtAddr != "" {
+		gossip.UpsertLocal(keyAdminExtAddr, local.AdminExtAddr)
+	}
+	for endpointID, count := range local.Endpoints {
+		gossip.UpsertLocal(endpointKeyPrefix+endpointID, strconv.Itoa(count))
+	}
+}
+
+// Readvertise re-publishes the local node's proxy/admin addresses, such as
+// after they change due to the host's network interfaces changing.
+func (s *syncer) Readvertise() {
+	s.mu.Lock()
+	gossip := s.gossip
+	s.mu.Unlock()
+	if gossip == nil {
+		return
+	}
+
+	local := s.networkMap.LocalNode()
+	gossip.UpsertLocal(keyProxyAddr, local.ProxyAddr)
+	gossip.UpsertLocal(keyAdminAddr, local.AdminAddr)
+
+	s.logger.Info(
+		"readvertised local addrs",
+		zap.String("proxy_addr", local.ProxyAddr),
+		zap.String("admin_addr", local.AdminAddr),
+	)
+}
+
+// ReadvertiseExt re-publishes the local node's externally-reachable
+// proxy/admin addresses, such as once a nat.Provider discovers or refreshes
+// them. An empty address deletes the corresponding key, so remote nodes
+// fall back to the plain address.
+func (s *syncer) ReadvertiseExt() {
+	s.mu.Lock()
+	gossip := s.gossip
+	s.mu.Unlock()
+	if gossip == nil {
+		return
+	}
+
+	local := s.networkMap.LocalNode()
+	upsertOrDelete(gossip, keyProxyExtAddr, local.ProxyExtAddr)
+	upsertOrDelete(gossip, keyAdminExtAddr, local.AdminExtAddr)
+
+	s.logger.Info(
+		"readvertised local external addrs",
+		zap.String("proxy_ext_addr", local.ProxyExtAddr),
+		zap.String("admin_ext_addr", local.AdminExtAddr),
+	)
+}
+
+func upsertOrDelete(gossip gossiper, key, value string) {
+	if value == "" {
+		gossip.DeleteLocal(key)
+		return
+	}
+	gossip.UpsertLocal(key, value)
+}
+
+func (s *syncer) onLocalEndpointUpdate(endpointID string, count int) {
+	s.mu.Lock()
+	gossip := s.gossip
+	s.mu.Unlock()
+	if gossip == nil {
+		return
+	}
+
+	key := endpointKeyPrefix + endpointID
+	if count <= 0 {
+		gossip.DeleteLocal(key)
+		return
+	}
+	gossip.UpsertLocal(key, strconv.Itoa(count))
+}
+
+func (s *syncer) isLocal(nodeID string) bool {
+	return nodeID == s.networkMap.LocalID()
+}
+
+// OnJoin is called when a new node is seen to have joined the cluster,
+// before any of its state has been gossiped.
+func (s *syncer) OnJoin(nodeID string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[nodeID] = &pendingNode{
+		joinedAt:  s.clock.Now(),
+		endpoints: make(map[string]int),
+	}
+	s.nodeLoggerLocked(nodeID).Debug("node pending")
+}
+
+// OnUpsertKey is called when a key has been added or updated for the given
+// node.
+func (s *syncer) OnUpsertKey(nodeID, key, value string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+
+	if key == keyProxyAddr {
+		s.bindNodeAddr(nodeID, value)
+	}
+
+	if _, ok := s.networkMap.Node(nodeID); ok {
+		s.applyUpsert(nodeID, key, value)
+		return
+	}
+
+	s.mu.Lock()
+	p, ok := s.pending[nodeID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+
+	switch {
+	case key == keyProxyAddr:
+		p.proxyAddr = value
+	case key == keyAdminAddr:
+		p.adminAddr = value
+	case key == keyProxyExtAddr:
+		p.proxyExtAddr = value
+	case key == keyAdminExtAddr:
+		p.adminExtAddr = value
+	case strings.HasPrefix(key, endpointKeyPrefix):
+		if count, err := strconv.Atoi(value); err == nil {
+			p.endpoints[strings.TrimPrefix(key, endpointKeyPrefix)] = count
+		}
+	}
+
+	var newNode *netmap.Node
+	if p.ready() {
+		newNode = &netmap.Node{
+			ID:           nodeID,
+			Status:       netmap.NodeStatusActive,
+			ProxyAddr:    p.proxyAddr,
+			AdminAddr:    p.adminAddr,
+			ProxyExtAddr: p.proxyExtAddr,
+			AdminExtAddr: p.adminExtAddr,
+			Endpoints:    p.endpoints,
+		}
+		delete(s.pending, nodeID)
+	}
+	logger := s.nodeLoggerLocked(nodeID)
+	callbacks := s.onNodeActive
+	s.mu.Unlock()
+
+	if newNode != nil {
+		s.networkMap.AddNode(newNode)
+		logger.Info("node active")
+		for _, f := range callbacks {
+			f(nodeID)
+		}
+	}
+}
+
+func (s *syncer) applyUpsert(nodeID, key, value string) {
+	switch {
+	case key == keyProxyAddr:
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			n.ProxyAddr = value
+		})
+	case key == keyAdminAddr:
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			n.AdminAddr = value
+		})
+	case key == keyProxyExtAddr:
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			n.ProxyExtAddr = value
+		})
+	case key == keyAdminExtAddr:
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			n.AdminExtAddr = value
+		})
+	case strings.HasPrefix(key, endpointKeyPrefix):
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return
+		}
+		endpointID := strings.TrimPrefix(key, endpointKeyPrefix)
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			if n.Endpoints == nil {
+				n.Endpoints = make(map[string]int)
+			}
+			n.Endpoints[endpointID] = count
+		})
+		s.endpointLogger(nodeID, endpointID, count).Debug("endpoint upsert")
+	}
+}
+
+// endpointLogger returns a sub-logger for endpoint churn on a node, scoped
+// to the endpoint's name and current listener count.
+func (s *syncer) endpointLogger(nodeID, endpointID string, count int) *log.Logger {
+	return s.nodeLogger(nodeID).With(
+		zap.String("endpoint_name", endpointID),
+		zap.Int("count", count),
+	)
+}
+
+// OnDeleteKey is called when a key has been removed for the given node.
+func (s *syncer) OnDeleteKey(nodeID, key string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+
+	switch {
+	case key == keyProxyExtAddr:
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			n.ProxyExtAddr = ""
+		})
+		return
+	case key == keyAdminExtAddr:
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			n.AdminExtAddr = ""
+		})
+		return
+	case !strings.HasPrefix(key, endpointKeyPrefix):
+		return
+	}
+
+	endpointID := strings.TrimPrefix(key, endpointKeyPrefix)
+
+	if _, ok := s.networkMap.Node(nodeID); ok {
+		s.networkMap.UpdateNode(nodeID, func(n *netmap.Node) {
+			delete(n.Endpoints, endpointID)
+		})
+		s.endpointLogger(nodeID, endpointID, 0).Debug("endpoint delete")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pending[nodeID]; ok {
+		delete(p.endpoints, endpointID)
+	}
+}
+
+// OnLeave is called when a node gracefully leaves the cluster.
+func (s *syncer) OnLeave(nodeID string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.pending[nodeID]; ok {
+		delete(s.pending, nodeID)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	s.networkMap.SetNodeStatus(nodeID, netmap.NodeStatusLeft)
+	s.nodeLogger(nodeID).Info("node left")
+}
+
+// OnDown is called when a node has stopped gossiping and may have crashed
+// or become partitioned.
+func (s *syncer) OnDown(nodeID string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+	s.networkMap.SetNodeStatus(nodeID, netmap.NodeStatusDown)
+	s.nodeLogger(nodeID).Warn("node down")
+}
+
+// OnHealthy is called when a node that was down starts gossiping again.
+func (s *syncer) OnHealthy(nodeID string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+	s.networkMap.SetNodeStatus(nodeID, netmap.NodeStatusActive)
+	s.nodeLogger(nodeID).Info("node recovered")
+}
+
+// OnExpired is called when a node is removed from the cluster, either after
+// leaving or being down long enough to be reaped.
+func (s *syncer) OnExpired(nodeID string) {
+	if s.isLocal(nodeID) {
+		return
+	}
+
+	s.mu.Lock()
+	logger := s.nodeLoggerLocked(nodeID)
+	delete(s.nodeLoggers, nodeID)
+	if _, ok := s.pending[nodeID]; ok {
+		delete(s.pending, nodeID)
+		s.mu.Unlock()
+		logger.Info("node expired")
+		return
+	}
+	s.mu.Unlock()
+
+	s.networkMap.RemoveNode(nodeID)
+	logger.Info("node expired")
+}
@@ -0,0 +1,84 @@
+package gossip
+
+import (
+	"testing"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/netmap"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyncer_NodeLoggerFields(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+
+	logger, logs := log.NewObservedLogger()
+	sync := newSyncer(m, realClock{}, logger)
+
+	sync.OnJoin("remote")
+	sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
+	sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
+
+	active := logs.FilterMessage("node active").All()
+	assert.Len(t, active, 1)
+	assert.Equal(t, "remote", active[0].ContextMap()["node_id"])
+	assert.Equal(t, "10.26.104.98:8000", active[0].ContextMap()["addr"])
+	assert.Contains(t, active[0].ContextMap(), "joined_at")
+
+	sync.OnDown("remote")
+	down := logs.FilterMessage("node down").All()
+	assert.Len(t, down, 1)
+	assert.Equal(t, "remote", down[0].ContextMap()["node_id"])
+	assert.Equal(t, zapcore.WarnLevel, down[0].Level)
+
+	sync.OnHealthy("remote")
+	recovered := logs.FilterMessage("node recovered").All()
+	assert.Len(t, recovered, 1)
+	assert.Equal(t, "remote", recovered[0].ContextMap()["node_id"])
+
+	sync.OnExpired("remote")
+	expired := logs.FilterMessage("node expired").All()
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "remote", expired[0].ContextMap()["node_id"])
+
+	// The logger is dropped once the node expires, so a later event creates
+	// a fresh one with no addr bound yet.
+	sync.OnDown("remote")
+	downAgain := logs.FilterMessage("node down").All()
+	assert.Len(t, downAgain, 2)
+	assert.NotContains(t, downAgain[1].ContextMap(), "addr")
+}
+
+func TestSyncer_EndpointLoggerFields(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+
+	logger, logs := log.NewObservedLogger()
+	sync := newSyncer(m, realClock{}, logger)
+
+	sync.OnJoin("remote")
+	sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
+	sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
+	sync.OnUpsertKey("remote", "endpoint:my-endpoint", "3")
+
+	upserts := logs.FilterMessage("endpoint upsert").All()
+	assert.Len(t, upserts, 1)
+	assert.Equal(t, "my-endpoint", upserts[0].ContextMap()["endpoint_name"])
+	assert.Equal(t, int64(3), upserts[0].ContextMap()["count"])
+
+	sync.OnDeleteKey("remote", "endpoint:my-endpoint")
+
+	deletes := logs.FilterMessage("endpoint delete").All()
+	assert.Len(t, deletes, 1)
+	assert.Equal(t, "my-endpoint", deletes[0].ContextMap()["endpoint_name"])
+	assert.Equal(t, int64(0), deletes[0].ContextMap()["count"])
+}
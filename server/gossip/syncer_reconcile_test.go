@@ -0,0 +1,183 @@
+package gossip
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/netmap"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a minimal Clock fake, interface-compatible with
+// github.com/benbjohnson/clock.Mock, for tests that need to deterministically
+// advance past the syncer's reconcile interval.
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	tick chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:  time.Unix(0, 0),
+		tick: make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(time.Duration) <-chan time.Time {
+	return c.tick
+}
+
+// Advance moves the clock forward by d and fires any pending After channel,
+// blocking until the syncer's reconcile loop has received the tick.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.tick <- now
+}
+
+func TestSyncer_ReconcileRepairsDivergedKeys(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+
+	clock := newFakeClock()
+	sy := newSyncer(m, clock, log.NewNopLogger())
+
+	gossiper := &fakeGossiper{}
+	sy.Sync(gossiper)
+
+	sy.OnJoin("remote")
+	sy.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
+	sy.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
+
+	// The gossip layer's authoritative state has since moved on: proxy_addr
+	// changed and a new endpoint was registered, but (say) the messages
+	// carrying those updates were dropped so the netmap never saw them.
+	gossiper.remoteState = map[string]map[string]string{
+		"remote": {
+			"proxy_addr":           "10.26.104.99:8000",
+			"admin_addr":           "10.26.104.98:8001",
+			"endpoint:my-endpoint": "2",
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- sy.Run(ctx) }()
+
+	clock.Advance(reconcileInterval)
+
+	assert.Eventually(t, func() bool {
+		node, ok := m.Node("remote")
+		if !ok {
+			return false
+		}
+		return node.ProxyAddr == "10.26.104.99:8000" && node.Endpoints["my-endpoint"] == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestSyncer_ReconcileDeletesStaleKeys(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+
+	clock := newFakeClock()
+	sy := newSyncer(m, clock, log.NewNopLogger())
+
+	gossiper := &fakeGossiper{}
+	sy.Sync(gossiper)
+
+	sy.OnJoin("remote")
+	sy.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
+	sy.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
+	sy.OnUpsertKey("remote", "endpoint:my-endpoint", "1")
+
+	// The gossip layer no longer has the endpoint key at all (such as the
+	// listener having been deregistered while the delete was dropped).
+	gossiper.remoteState = map[string]map[string]string{
+		"remote": {
+			"proxy_addr": "10.26.104.98:8000",
+			"admin_addr": "10.26.104.98:8001",
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- sy.Run(ctx) }()
+
+	clock.Advance(reconcileInterval)
+
+	assert.Eventually(t, func() bool {
+		node, ok := m.Node("remote")
+		if !ok {
+			return false
+		}
+		_, hasEndpoint := node.Endpoints["my-endpoint"]
+		return !hasEndpoint
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestSyncer_ReconcileDropsStalePending(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+
+	clock := newFakeClock()
+	sy := newSyncer(m, clock, log.NewNopLogger())
+
+	gossiper := &fakeGossiper{}
+	sy.Sync(gossiper)
+
+	// Joins but never gossips admin_addr, so it never becomes ready.
+	sy.OnJoin("remote")
+	sy.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- sy.Run(ctx) }()
+
+	clock.Advance(pendingGracePeriod + time.Second)
+
+	assert.Eventually(t, func() bool {
+		sy.mu.Lock()
+		defer sy.mu.Unlock()
+		_, ok := sy.pending["remote"]
+		return !ok
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
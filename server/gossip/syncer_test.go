@@ -4,7 +4,7 @@ import (
 	"testing"
 
 	"github.com/andydunstall/pico/pkg/log"
-	netmap "github.com/andydunstall/pico/server/netmapv2"
+	"github.com/andydunstall/pico/server/netmap"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,19 +16,24 @@ type upsert struct {
 type fakeGossiper struct {
 	upserts []upsert
 	deletes []string
+
+	// remoteState simulates the authoritative per-node key/value sets held
+	// by the wider gossip layer, as returned by SnapshotRemote.
+	remoteState map[string]map[string]string
 }
 
 func (g *fakeGossiper) UpsertLocal(key, value string) {
-	g.upserts = append(g.upserts, upsert{
-		Key:   key,
-		Value: value,
-	})
+	g.upserts = append(g.upserts, upsert{Key: key, Value: value})
 }
 
 func (g *fakeGossiper) DeleteLocal(key string) {
 	g.deletes = append(g.deletes, key)
 }
 
+func (g *fakeGossiper) SnapshotRemote(nodeID string) map[string]string {
+	return g.remoteState[nodeID]
+}
+
 var _ gossiper = &fakeGossiper{}
 
 func TestSyncer_Sync(t *testing.T) {
@@ -39,10 +44,8 @@ func TestSyncer_Sync(t *testing.T) {
 	}
 	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 	m.AddLocalEndpoint("my-endpoint")
-	m.AddLocalEndpoint("my-endpoint")
-	m.AddLocalEndpoint("my-endpoint")
 
-	sync := newSyncer(m, log.NewNopLogger())
+	sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 	gossiper := &fakeGossiper{}
 	sync.Sync(gossiper)
@@ -52,13 +55,13 @@ func TestSyncer_Sync(t *testing.T) {
 		[]upsert{
 			{"proxy_addr", "10.26.104.56:8000"},
 			{"admin_addr", "10.26.104.56:8001"},
-			{"endpoint:my-endpoint", "3"},
+			{"endpoint:my-endpoint", "1"},
 		},
 		gossiper.upserts,
 	)
 }
 
-func TestSyncer_OnLocalEndpointUpdate(t *testing.T) {
+func TestSyncer_Readvertise(t *testing.T) {
 	localNode := &netmap.Node{
 		ID:        "local",
 		ProxyAddr: "10.26.104.56:8000",
@@ -66,26 +69,40 @@ func TestSyncer_OnLocalEndpointUpdate(t *testing.T) {
 	}
 	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-	sync := newSyncer(m, log.NewNopLogger())
+	sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 	gossiper := &fakeGossiper{}
 	sync.Sync(gossiper)
 
-	m.AddLocalEndpoint("my-endpoint")
+	m.UpdateLocalAddrs("10.26.104.99:8000", "10.26.104.99:8001")
+	sync.Readvertise()
+
 	assert.Equal(
 		t,
-		upsert{"endpoint:my-endpoint", "1"},
+		upsert{"admin_addr", "10.26.104.99:8001"},
 		gossiper.upserts[len(gossiper.upserts)-1],
 	)
-
-	m.AddLocalEndpoint("my-endpoint")
 	assert.Equal(
 		t,
-		upsert{"endpoint:my-endpoint", "2"},
-		gossiper.upserts[len(gossiper.upserts)-1],
+		upsert{"proxy_addr", "10.26.104.99:8000"},
+		gossiper.upserts[len(gossiper.upserts)-2],
 	)
+}
 
-	m.RemoveLocalEndpoint("my-endpoint")
+func TestSyncer_OnLocalEndpointUpdate(t *testing.T) {
+	localNode := &netmap.Node{
+		ID:        "local",
+		ProxyAddr: "10.26.104.56:8000",
+		AdminAddr: "10.26.104.56:8001",
+	}
+	m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
+
+	sync := newSyncer(m, realClock{}, log.NewNopLogger())
+
+	gossiper := &fakeGossiper{}
+	sync.Sync(gossiper)
+
+	m.AddLocalEndpoint("my-endpoint")
 	assert.Equal(
 		t,
 		upsert{"endpoint:my-endpoint", "1"},
@@ -109,48 +126,29 @@ func TestSyncer_RemoteNodeUpdate(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
+
+		_, ok := m.Node("remote")
+		assert.False(t, ok)
+
 		sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
 		sync.OnUpsertKey("remote", "endpoint:my-endpoint", "5")
 
 		node, ok := m.Node("remote")
 		assert.True(t, ok)
-		assert.Equal(t, node, &netmap.Node{
+		assert.Equal(t, &netmap.Node{
 			ID:        "remote",
 			Status:    netmap.NodeStatusActive,
 			ProxyAddr: "10.26.104.98:8000",
 			AdminAddr: "10.26.104.98:8001",
-			Endpoints: map[string]int{
-				"my-endpoint": 5,
-			},
-		})
-	})
-
-	t.Run("add node missing state", func(t *testing.T) {
-		localNode := &netmap.Node{
-			ID:        "local",
-			ProxyAddr: "10.26.104.56:8000",
-			AdminAddr: "10.26.104.56:8001",
-		}
-		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
-
-		sync := newSyncer(m, log.NewNopLogger())
-
-		gossiper := &fakeGossiper{}
-		sync.Sync(gossiper)
-
-		sync.OnJoin("remote")
-		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
-
-		// We don't have the node status therefore it is still pending.
-		_, ok := m.Node("remote")
-		assert.False(t, ok)
+			Endpoints: map[string]int{"my-endpoint": 5},
+		}, node)
 	})
 
 	t.Run("add local node", func(t *testing.T) {
@@ -162,56 +160,18 @@ func TestSyncer_RemoteNodeUpdate(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Updates to the local node should have no affect.
+		// Updates to the local node should have no effect.
 		sync.OnJoin("local")
 		sync.OnUpsertKey("local", "proxy_addr", "10.26.104.98:8000")
 		sync.OnUpsertKey("local", "admin_addr", "10.26.104.98:8001")
 
 		assert.Equal(t, localNode, m.LocalNode())
 	})
-
-	t.Run("update node", func(t *testing.T) {
-		localNode := &netmap.Node{
-			ID:        "local",
-			Status:    netmap.NodeStatusActive,
-			ProxyAddr: "10.26.104.56:8000",
-			AdminAddr: "10.26.104.56:8001",
-		}
-		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
-
-		sync := newSyncer(m, log.NewNopLogger())
-
-		gossiper := &fakeGossiper{}
-		sync.Sync(gossiper)
-
-		sync.OnJoin("remote")
-		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
-		sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
-		sync.OnUpsertKey("remote", "endpoint:my-endpoint", "5")
-
-		_, ok := m.Node("remote")
-		assert.True(t, ok)
-
-		sync.OnUpsertKey("remote", "endpoint:my-endpoint-2", "8")
-		sync.OnDeleteKey("remote", "endpoint:my-endpoint")
-
-		node, ok := m.Node("remote")
-		assert.True(t, ok)
-		assert.Equal(t, node, &netmap.Node{
-			ID:        "remote",
-			Status:    netmap.NodeStatusActive,
-			ProxyAddr: "10.26.104.98:8000",
-			AdminAddr: "10.26.104.98:8001",
-			Endpoints: map[string]int{
-				"my-endpoint-2": 8,
-			},
-		})
-	})
 }
 
 func TestSyncer_RemoteNodeLeave(t *testing.T) {
@@ -223,35 +183,23 @@ func TestSyncer_RemoteNodeLeave(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Add remote node.
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
 		sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
-		sync.OnUpsertKey("remote", "endpoint:my-endpoint", "5")
 
-		// Leaving should update the netmap.
 		sync.OnLeave("remote")
 
 		node, ok := m.Node("remote")
 		assert.True(t, ok)
-		assert.Equal(t, node, &netmap.Node{
-			ID:        "remote",
-			Status:    netmap.NodeStatusLeft,
-			ProxyAddr: "10.26.104.98:8000",
-			AdminAddr: "10.26.104.98:8001",
-			Endpoints: map[string]int{
-				"my-endpoint": 5,
-			},
-		})
+		assert.Equal(t, netmap.NodeStatusLeft, node.Status)
 
 		sync.OnExpired("remote")
 
-		// Expiring should remove from the netmap.
 		_, ok = m.Node("remote")
 		assert.False(t, ok)
 	})
@@ -264,12 +212,11 @@ func TestSyncer_RemoteNodeLeave(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Add remote node.
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
 
@@ -291,12 +238,12 @@ func TestSyncer_RemoteNodeLeave(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Attempting to mark the local node as left should have no affect.
+		// Attempting to mark the local node as left should have no effect.
 		sync.OnLeave("local")
 
 		assert.Equal(t, localNode, m.LocalNode())
@@ -312,35 +259,30 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Add remote node.
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
 		sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
 		sync.OnUpsertKey("remote", "endpoint:my-endpoint", "5")
 
-		// Marking a node down should update the netmap.
 		sync.OnDown("remote")
 
 		node, ok := m.Node("remote")
 		assert.True(t, ok)
-		assert.Equal(t, node, &netmap.Node{
+		assert.Equal(t, &netmap.Node{
 			ID:        "remote",
 			Status:    netmap.NodeStatusDown,
 			ProxyAddr: "10.26.104.98:8000",
 			AdminAddr: "10.26.104.98:8001",
-			Endpoints: map[string]int{
-				"my-endpoint": 5,
-			},
-		})
+			Endpoints: map[string]int{"my-endpoint": 5},
+		}, node)
 
 		sync.OnExpired("remote")
 
-		// Expiring should remove from the netmap.
 		_, ok = m.Node("remote")
 		assert.False(t, ok)
 	})
@@ -353,34 +295,28 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Add remote node.
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
 		sync.OnUpsertKey("remote", "admin_addr", "10.26.104.98:8001")
 		sync.OnUpsertKey("remote", "endpoint:my-endpoint", "5")
 
-		// Marking a node down should update the netmap.
 		sync.OnDown("remote")
-
-		// Marking a node healthy should update the netmap.
 		sync.OnHealthy("remote")
 
 		node, ok := m.Node("remote")
 		assert.True(t, ok)
-		assert.Equal(t, node, &netmap.Node{
+		assert.Equal(t, &netmap.Node{
 			ID:        "remote",
 			Status:    netmap.NodeStatusActive,
 			ProxyAddr: "10.26.104.98:8000",
 			AdminAddr: "10.26.104.98:8001",
-			Endpoints: map[string]int{
-				"my-endpoint": 5,
-			},
-		})
+			Endpoints: map[string]int{"my-endpoint": 5},
+		}, node)
 	})
 
 	t.Run("pending node down", func(t *testing.T) {
@@ -391,12 +327,11 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Add remote node.
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
 
@@ -408,12 +343,12 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 
 		node, ok := m.Node("remote")
 		assert.True(t, ok)
-		assert.Equal(t, node, &netmap.Node{
+		assert.Equal(t, &netmap.Node{
 			ID:        "remote",
 			Status:    netmap.NodeStatusActive,
 			ProxyAddr: "10.26.104.98:8000",
 			AdminAddr: "10.26.104.98:8001",
-		})
+		}, node)
 	})
 
 	t.Run("pending node expires", func(t *testing.T) {
@@ -424,16 +359,14 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Add remote node.
 		sync.OnJoin("remote")
 		sync.OnUpsertKey("remote", "proxy_addr", "10.26.104.98:8000")
 
-		// Marking down should not remove the pending node.
 		sync.OnDown("remote")
 		sync.OnExpired("remote")
 
@@ -443,7 +376,7 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 		assert.False(t, ok)
 	})
 
-	t.Run("local node leave", func(t *testing.T) {
+	t.Run("local node down", func(t *testing.T) {
 		localNode := &netmap.Node{
 			ID:        "local",
 			Status:    netmap.NodeStatusActive,
@@ -452,13 +385,13 @@ func TestSyncer_RemoteNodeDown(t *testing.T) {
 		}
 		m := netmap.NewNetworkMap(localNode.Copy(), log.NewNopLogger())
 
-		sync := newSyncer(m, log.NewNopLogger())
+		sync := newSyncer(m, realClock{}, log.NewNopLogger())
 
 		gossiper := &fakeGossiper{}
 		sync.Sync(gossiper)
 
-		// Attempting to mark the local node as down should have no affect.
-		sync.OnLeave("local")
+		// Attempting to mark the local node as down should have no effect.
+		sync.OnDown("local")
 
 		assert.Equal(t, localNode, m.LocalNode())
 	})
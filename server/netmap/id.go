@@ -0,0 +1,15 @@
+package netmap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// GenerateNodeID returns a random ID suitable for identifying a node in the
+// cluster.
+func GenerateNodeID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,185 @@
+// Package netmap maintains the known state of the cluster as observed via
+// gossip, including the local node.
+package netmap
+
+import (
+	"sync"
+
+	"github.com/andydunstall/pico/pkg/log"
+)
+
+// NetworkMap maintains the set of nodes known to be in the cluster,
+// including the local node.
+//
+// It is updated by the gossip syncer and read by the proxy to route
+// requests to the node registered for an endpoint.
+type NetworkMap struct {
+	localID string
+	nodes   map[string]*Node
+
+	localEndpointWatchers []func(endpointID string, count int)
+
+	mu     sync.Mutex
+	logger *log.Logger
+}
+
+// NewNetworkMap creates a network map seeded with the given local node.
+func NewNetworkMap(localNode *Node, logger *log.Logger) *NetworkMap {
+	if localNode.Endpoints == nil {
+		localNode.Endpoints = make(map[string]int)
+	}
+	return &NetworkMap{
+		localID: localNode.ID,
+		nodes: map[string]*Node{
+			localNode.ID: localNode,
+		},
+		logger: logger,
+	}
+}
+
+// LocalID returns the ID of the local node.
+func (m *NetworkMap) LocalID() string {
+	return m.localID
+}
+
+// LocalNode returns a copy of the local node.
+func (m *NetworkMap) LocalNode() *Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.nodes[m.localID].Copy()
+}
+
+// Node looks up the node with the given ID.
+func (m *NetworkMap) Node(id string) (*Node, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, ok := m.nodes[id]
+	if !ok {
+		return nil, false
+	}
+	return node.Copy(), true
+}
+
+// Nodes returns a copy of all known nodes.
+func (m *NetworkMap) Nodes() []*Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := make([]*Node, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		nodes = append(nodes, node.Copy())
+	}
+	return nodes
+}
+
+// AddLocalEndpoint registers a listener for the given endpoint on the local
+// node, incrementing its listener count.
+func (m *NetworkMap) AddLocalEndpoint(endpointID string) {
+	m.mu.Lock()
+	local := m.nodes[m.localID]
+	local.Endpoints[endpointID]++
+	count := local.Endpoints[endpointID]
+	watchers := m.localEndpointWatchers
+	m.mu.Unlock()
+
+	for _, watch := range watchers {
+		watch(endpointID, count)
+	}
+}
+
+// RemoveLocalEndpoint removes a listener for the given endpoint from the
+// local node, decrementing its listener count.
+func (m *NetworkMap) RemoveLocalEndpoint(endpointID string) {
+	m.mu.Lock()
+	local := m.nodes[m.localID]
+	count := 0
+	if local.Endpoints[endpointID] > 0 {
+		local.Endpoints[endpointID]--
+		count = local.Endpoints[endpointID]
+	}
+	if count <= 0 {
+		delete(local.Endpoints, endpointID)
+	}
+	watchers := m.localEndpointWatchers
+	m.mu.Unlock()
+
+	for _, watch := range watchers {
+		watch(endpointID, count)
+	}
+}
+
+// UpdateLocalAddrs updates the addresses advertised for the local node,
+// returning whether either address actually changed.
+func (m *NetworkMap) UpdateLocalAddrs(proxyAddr, adminAddr string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	local := m.nodes[m.localID]
+	changed := local.ProxyAddr != proxyAddr || local.AdminAddr != adminAddr
+	local.ProxyAddr = proxyAddr
+	local.AdminAddr = adminAddr
+	return changed
+}
+
+// UpdateLocalExtAddrs updates the externally-reachable addresses advertised
+// for the local node (such as once discovered by nat.Service), returning
+// whether either address actually changed. An empty value clears the
+// corresponding external address, falling back to the plain address.
+func (m *NetworkMap) UpdateLocalExtAddrs(proxyExtAddr, adminExtAddr string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	local := m.nodes[m.localID]
+	changed := local.ProxyExtAddr != proxyExtAddr || local.AdminExtAddr != adminExtAddr
+	local.ProxyExtAddr = proxyExtAddr
+	local.AdminExtAddr = adminExtAddr
+	return changed
+}
+
+// OnLocalEndpointUpdate registers a callback invoked whenever a local
+// endpoint's listener count changes, with the endpoint's new count (0 once
+// the last listener has been removed). Callbacks run synchronously on the
+// goroutine that mutated the endpoint.
+func (m *NetworkMap) OnLocalEndpointUpdate(f func(endpointID string, count int)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.localEndpointWatchers = append(m.localEndpointWatchers, f)
+}
+
+// AddNode adds a newly discovered remote node to the map.
+func (m *NetworkMap) AddNode(node *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[node.ID] = node.Copy()
+}
+
+// UpdateNode applies mutate to a copy of the node with the given ID and
+// stores the result. Returns false if the node isn't known.
+func (m *NetworkMap) UpdateNode(id string, mutate func(*Node)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[id]
+	if !ok {
+		return false
+	}
+	updated := node.Copy()
+	mutate(updated)
+	m.nodes[id] = updated
+	return true
+}
+
+// SetNodeStatus updates the status of a known node. Returns false if the
+// node isn't known.
+func (m *NetworkMap) SetNodeStatus(id string, status NodeStatus) bool {
+	return m.UpdateNode(id, func(n *Node) {
+		n.Status = status
+	})
+}
+
+// RemoveNode removes a node from the map, such as once it has expired from
+// the cluster.
+func (m *NetworkMap) RemoveNode(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.nodes, id)
+}
@@ -0,0 +1,88 @@
+package netmap
+
+// NodeStatus is the status of a node as seen by the local node.
+type NodeStatus int
+
+const (
+	// NodeStatusPending indicates the node has joined the cluster but we're
+	// still waiting on gossip to receive its full state (such as its
+	// proxy/admin addresses).
+	NodeStatusPending NodeStatus = iota
+	// NodeStatusActive indicates the node is a known healthy member of the
+	// cluster.
+	NodeStatusActive
+	// NodeStatusDown indicates the node has stopped gossiping, so may have
+	// crashed or become partitioned.
+	NodeStatusDown
+	// NodeStatusLeft indicates the node has gracefully left the cluster.
+	NodeStatusLeft
+)
+
+func (s NodeStatus) String() string {
+	switch s {
+	case NodeStatusPending:
+		return "pending"
+	case NodeStatusActive:
+		return "active"
+	case NodeStatusDown:
+		return "down"
+	case NodeStatusLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+// Node is a member of the cluster, as seen via gossip.
+type Node struct {
+	ID        string
+	Status    NodeStatus
+	ProxyAddr string
+	AdminAddr string
+	// ProxyExtAddr and AdminExtAddr are the addresses at which the node is
+	// reachable from outside its local network (such as behind NAT), set
+	// once a nat.Provider has discovered them. Empty unless NAT traversal
+	// is configured and has succeeded.
+	ProxyExtAddr string
+	AdminExtAddr string
+	// Endpoints maps an endpoint ID to the number of listeners for that
+	// endpoint registered on this node.
+	Endpoints map[string]int
+}
+
+// EffectiveProxyAddr returns the address the rest of the cluster should use
+// to reach this node's proxy listener: its external address if known,
+// otherwise its plain address.
+func (n *Node) EffectiveProxyAddr() string {
+	if n.ProxyExtAddr != "" {
+		return n.ProxyExtAddr
+	}
+	return n.ProxyAddr
+}
+
+// EffectiveAdminAddr returns the address the rest of the cluster should use
+// to reach this node's admin listener: its external address if known,
+// otherwise its plain address.
+func (n *Node) EffectiveAdminAddr() string {
+	if n.AdminExtAddr != "" {
+		return n.AdminExtAddr
+	}
+	return n.AdminAddr
+}
+
+// Copy returns a deep copy of the node.
+func (n *Node) Copy() *Node {
+	endpoints := make(map[string]int, len(n.Endpoints))
+	for id, count := range n.Endpoints {
+		endpoints[id] = count
+	}
+	return &Node{
+		ID:           n.ID,
+		Status:       n.Status,
+		ProxyAddr:    n.ProxyAddr,
+		AdminAddr:    n.AdminAddr,
+		ProxyExtAddr: n.ProxyExtAddr,
+		AdminExtAddr: n.AdminExtAddr,
+		Endpoints:    endpoints,
+	}
+}
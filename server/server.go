@@ -0,0 +1,126 @@
+// Package server runs the Pico server node's listeners: the proxy listener
+// that serves downstream clients and upstream listeners, and the admin
+// listener used for health checks, metrics and cluster status.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/andydunstall/pico/pkg/log"
+	"github.com/andydunstall/pico/server/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReadyChecker reports whether the node is ready to serve traffic, such as
+// having joined the cluster and synced with its peers.
+type ReadyChecker interface {
+	IsReady() bool
+}
+
+// Server runs the Pico server node's proxy and admin listeners.
+type Server struct {
+	ready ReadyChecker
+
+	proxyLn *http.Server
+	adminLn *http.Server
+
+	logger *log.Logger
+}
+
+// NewServer creates a server node listening for proxy traffic on listenAddr
+// and admin traffic on conf.Server.AdminListenAddr.
+func NewServer(
+	listenAddr string,
+	registry *prometheus.Registry,
+	conf *config.Config,
+	ready ReadyChecker,
+	logger *log.Logger,
+) *Server {
+	logger = logger.WithSubsystem("server")
+
+	s := &Server{
+		ready:  ready,
+		logger: logger,
+	}
+
+	proxyMux := http.NewServeMux()
+	// TODO(andydunstall): Proxy downstream client and upstream listener
+	// traffic to the node registered for the requested endpoint.
+	s.proxyLn = &http.Server{
+		Addr:    listenAddr,
+		Handler: proxyMux,
+	}
+
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/health/ready", s.healthReady)
+	adminMux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	s.adminLn = &http.Server{
+		Addr:    conf.Server.AdminListenAddr,
+		Handler: adminMux,
+	}
+
+	return s
+}
+
+// Serve starts the proxy and admin listeners, blocking until either fails
+// or Shutdown is called.
+func (s *Server) Serve() error {
+	proxyLis, err := net.Listen("tcp", s.proxyLn.Addr)
+	if err != nil {
+		return fmt.Errorf("listen: %s: %w", s.proxyLn.Addr, err)
+	}
+	adminLis, err := net.Listen("tcp", s.adminLn.Addr)
+	if err != nil {
+		return fmt.Errorf("listen: %s: %w", s.adminLn.Addr, err)
+	}
+
+	var group errgroup.Group
+	group.Go(func() error {
+		s.logger.Info("starting proxy listener", zap.String("addr", s.proxyLn.Addr))
+		if err := s.proxyLn.Serve(proxyLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		return nil
+	})
+	group.Go(func() error {
+		s.logger.Info("starting admin listener", zap.String("addr", s.adminLn.Addr))
+		if err := s.adminLn.Serve(adminLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("admin: %w", err)
+		}
+		return nil
+	})
+	return group.Wait()
+}
+
+// Shutdown gracefully shuts down the proxy and admin listeners, waiting for
+// in-progress requests to complete until ctx is cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if shutdownErr := s.proxyLn.Shutdown(ctx); shutdownErr != nil {
+		err = fmt.Errorf("proxy: %w", shutdownErr)
+	}
+	if shutdownErr := s.adminLn.Shutdown(ctx); shutdownErr != nil && err == nil {
+		err = fmt.Errorf("admin: %w", shutdownErr)
+	}
+	return err
+}
+
+// healthReady returns 200 once the node is ready to serve traffic, and 503
+// otherwise, so load balancers and Kubernetes readiness probes hold traffic
+// off the node until then.
+func (s *Server) healthReady(w http.ResponseWriter, _ *http.Request) {
+	if !s.ready.IsReady() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ready"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}